@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// batchGetSize is the most keys BatchGetItem accepts in one request.
+const batchGetSize = 100
+
+// readKeys parses the -statement flags followed by each line of the keys
+// file, skipping blank lines.
+func readKeys(statements []string, file string) ([]*keyValue, error) {
+	var keys []*keyValue
+	add := func(statement string) error {
+		key := &keyValue{}
+		if err := parseStatement(statement, key); err != nil {
+			return err
+		}
+		if len(key.Attributes) > 2 {
+			return validationErrorf("Expected one or two key=value pair(s) for a batch-get request, got %s", statement)
+		}
+		keys = append(keys, key)
+		return nil
+	}
+	for _, statement := range statements {
+		if err := add(statement); err != nil {
+			return nil, err
+		}
+	}
+	if file == "" {
+		return keys, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := add(line); err != nil {
+			return nil, err
+		}
+	}
+	return keys, scanner.Err()
+}
+
+// batchGet reads every key with BatchGetItem, 100 keys at a time, and writes
+// the items in the same order as the keys. Keys that don't exist are written
+// as null.
+func batchGet(args ddbArgs) (string, error) {
+	if len(args.Keys) == 0 {
+		return "", validationErrorf("Expected at least one key to get")
+	}
+	var keyNames []string
+	for _, attribute := range args.Keys[0].Attributes {
+		keyNames = append(keyNames, attribute.Key)
+	}
+	sort.Strings(keyNames)
+
+	var err error
+	keys := make([]map[string]*dynamodb.AttributeValue, len(args.Keys))
+	for i, key := range args.Keys {
+		keys[i], err = buildKey(key.Attributes)
+		if err != nil {
+			return "", err
+		}
+		var names []string
+		for name := range keys[i] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != strings.Join(keyNames, ",") {
+			return "", validationErrorf("Expected every key to have the attributes %s, got %s", strings.Join(keyNames, ", "), strings.Join(names, ", "))
+		}
+	}
+
+	writer, err := newItemWriter(args.Output, args.Format)
+	if err != nil {
+		return "", err
+	}
+	// Duplicate keys can't be sent in one request, so each batch holds up to
+	// 100 distinct keys, and the keys in the input that share them.
+	start := 0
+	unique := map[string]bool{}
+	for i := 0; i <= len(keys); i++ {
+		if i < len(keys) {
+			id := keyIdentity(keys[i], keyNames)
+			if unique[id] || len(unique) < batchGetSize {
+				unique[id] = true
+				continue
+			}
+		}
+		items, err := batchGetKeys(args, keys[start:i], keyNames)
+		if err != nil {
+			return "", err
+		}
+		if err := writer.Write(items); err != nil {
+			return "", err
+		}
+		start = i
+		unique = map[string]bool{}
+		if i < len(keys) {
+			unique[keyIdentity(keys[i], keyNames)] = true
+		}
+	}
+	return "", writer.Close()
+}
+
+// batchGetKeys gets up to 100 distinct keys, retrying unprocessed keys with
+// exponential backoff, and returns the items in the same order as the keys.
+func batchGetKeys(args ddbArgs, keys []map[string]*dynamodb.AttributeValue, keyNames []string) ([]map[string]*dynamodb.AttributeValue, error) {
+	request := &dynamodb.KeysAndAttributes{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		id := keyIdentity(key, keyNames)
+		if !seen[id] {
+			seen[id] = true
+			request.Keys = append(request.Keys, key)
+		}
+	}
+
+	// Items are matched to keys by their key attributes, so they must be
+	// projected even if they weren't asked for.
+	var hidden []string
+	if args.Projection != nil {
+		projection := &projection{Paths: args.Projection.Paths}
+		for _, name := range keyNames {
+			if !projection.includes(name) {
+				projection.Paths = append(projection.Paths, &documentPath{Name: name})
+				hidden = append(hidden, name)
+			}
+		}
+		builder := newExpressionBuilder()
+		request.ProjectionExpression = aws.String(projection.expression(builder))
+		request.ExpressionAttributeNames = builder.attributeNames()
+	}
+
+	found := map[string]map[string]*dynamodb.AttributeValue{}
+	for attempt := 0; request != nil && len(request.Keys) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > maxBatchRetries {
+				return nil, &throttlingError{serviceError{
+					code:    "UnprocessedKeys",
+					message: fmt.Sprintf("%d keys were still unprocessed after retrying", len(request.Keys)),
+				}}
+			}
+			sleep(backoff(attempt))
+		}
+		resp, err := args.Client.BatchGetItem(&dynamodb.BatchGetItemInput{
+			RequestItems: map[string]*dynamodb.KeysAndAttributes{
+				args.Table: request,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Responses[args.Table] {
+			found[keyIdentity(item, keyNames)] = item
+		}
+		request = resp.UnprocessedKeys[args.Table]
+	}
+
+	items := make([]map[string]*dynamodb.AttributeValue, len(keys))
+	for i, key := range keys {
+		item := found[keyIdentity(key, keyNames)]
+		if item != nil && len(hidden) > 0 {
+			copied := map[string]*dynamodb.AttributeValue{}
+			for k, v := range item {
+				if !contains(hidden, k) {
+					copied[k] = v
+				}
+			}
+			item = copied
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// keyIdentity returns a string that is the same for equal keys. Numbers are
+// compared by value, as DynamoDB returns 1.0 as 1.
+func keyIdentity(item map[string]*dynamodb.AttributeValue, keyNames []string) string {
+	key := map[string]*dynamodb.AttributeValue{}
+	for _, name := range keyNames {
+		av := item[name]
+		if av == nil {
+			continue
+		}
+		if av.N != nil {
+			if r, ok := new(big.Rat).SetString(*av.N); ok {
+				av = &dynamodb.AttributeValue{N: aws.String(r.RatString())}
+			}
+		}
+		key[name] = av
+	}
+	id, _ := json.Marshal(itemToDynamoJSON(key))
+	return string(id)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// BatchGetItem finds every key except those starting with "missing", and
+// returns the items in reverse order. Keys starting with "slow" are left
+// unprocessed the first time they are requested. Numeric keys are returned
+// without a trailing ".0", as DynamoDB does.
+func (d *mockDynamo) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+	d.batchGets = append(d.batchGets, input)
+	if d.retried == nil {
+		d.retried = map[string]bool{}
+	}
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]*dynamodb.AttributeValue{},
+		UnprocessedKeys: map[string]*dynamodb.KeysAndAttributes{},
+	}
+	for table, request := range input.RequestItems {
+		for _, key := range request.Keys {
+			if n := key["n"]; n != nil {
+				output.Responses[table] = append([]map[string]*dynamodb.AttributeValue{{
+					"n": {N: aws.String(strings.TrimSuffix(*n.N, ".0"))},
+				}}, output.Responses[table]...)
+				continue
+			}
+			id := aws.StringValue(key["id"].S)
+			if strings.HasPrefix(id, "slow") && !d.retried[id] {
+				d.retried[id] = true
+				if output.UnprocessedKeys[table] == nil {
+					output.UnprocessedKeys[table] = &dynamodb.KeysAndAttributes{}
+				}
+				output.UnprocessedKeys[table].Keys = append(output.UnprocessedKeys[table].Keys, key)
+				continue
+			}
+			if strings.HasPrefix(id, "missing") {
+				continue
+			}
+			output.Responses[table] = append([]map[string]*dynamodb.AttributeValue{{
+				"id":    {S: aws.String(id)},
+				"value": {S: aws.String("item " + id)},
+			}}, output.Responses[table]...)
+		}
+	}
+	return output, nil
+}
+
+func batchGetSetup(t *testing.T, client *mockDynamo, statements []string, file string, projection *projection) string {
+	sleep = func(time.Duration) {}
+	keys, err := readKeys(statements, file)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	output := &bytes.Buffer{}
+	_, err = run(ddbArgs{
+		Client:     client,
+		Command:    "batch-get",
+		Table:      "testing",
+		Keys:       keys,
+		Projection: projection,
+		Output:     output,
+		Format:     "jsonl",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	return output.String()
+}
+
+func TestBatchGet(t *testing.T) {
+	client := &mockDynamo{}
+	output := batchGetSetup(t, client, []string{`id="a"`, `id="missing"`, `id="slow"`, `id="a"`}, "", nil)
+	expected := `{"id":"a","value":"item a"}
+null
+{"id":"slow","value":"item slow"}
+{"id":"a","value":"item a"}
+`
+	if output != expected {
+		t.Errorf("Expected %s, got %s", expected, output)
+	}
+	if len(client.batchGets) != 2 {
+		t.Fatalf("Expected two BatchGetItem requests, got %d", len(client.batchGets))
+	}
+	if n := len(client.batchGets[0].RequestItems["testing"].Keys); n != 3 {
+		t.Errorf("Expected duplicate keys to be requested once, got %d keys", n)
+	}
+	if n := len(client.batchGets[1].RequestItems["testing"].Keys); n != 1 {
+		t.Errorf("Expected only the unprocessed key to be retried, got %d keys", n)
+	}
+}
+
+func TestBatchGetKeysFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	for i := 0; i < 250; i++ {
+		fmt.Fprintf(f, "id=\"%d\"\n\n", i)
+	}
+	f.Close()
+
+	client := &mockDynamo{}
+	output := batchGetSetup(t, client, []string{`id="first"`}, f.Name(), nil)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 251 {
+		t.Fatalf("Expected 251 items, got %d", len(lines))
+	}
+	if lines[0] != `{"id":"first","value":"item first"}` || lines[250] != `{"id":"249","value":"item 249"}` {
+		t.Errorf("Expected items in the order of the keys, got %s and %s", lines[0], lines[250])
+	}
+	sizes := []int{100, 100, 51}
+	if len(client.batchGets) != len(sizes) {
+		t.Fatalf("Expected %d BatchGetItem requests, got %d", len(sizes), len(client.batchGets))
+	}
+	for i, size := range sizes {
+		if n := len(client.batchGets[i].RequestItems["testing"].Keys); n != size {
+			t.Errorf("Expected request %d to have %d keys, got %d", i, size, n)
+		}
+	}
+}
+
+func TestBatchGetNumberKeys(t *testing.T) {
+	output := batchGetSetup(t, &mockDynamo{}, []string{`n=1.0`, `n=2`}, "", nil)
+	expected := `{"n":1}
+{"n":2}
+`
+	if output != expected {
+		t.Errorf("Expected %s, got %s", expected, output)
+	}
+}
+
+func TestBatchGetProjection(t *testing.T) {
+	client := &mockDynamo{}
+	p := &projection{}
+	parseStatement("value", p)
+	output := batchGetSetup(t, client, []string{`id="a"`}, "", p)
+	if output != `{"value":"item a"}`+"\n" {
+		t.Errorf("Expected only the projected attributes, got %s", output)
+	}
+	request := client.batchGets[0].RequestItems["testing"]
+	if *request.ProjectionExpression != "#n0, #n1" || *request.ExpressionAttributeNames["#n1"] != "id" {
+		t.Errorf("Expected the key to be projected, got %s", *request.ProjectionExpression)
+	}
+}
+
+func TestBatchGetInvalidKeys(t *testing.T) {
+	_, err := readKeys([]string{`a=1,b=2,c=3`}, "")
+	if err == nil {
+		t.Errorf("Expected an error for a key with three attributes")
+	}
+	keys, _ := readKeys([]string{`a=1`, `b=2`}, "")
+	_, err = run(ddbArgs{
+		Client:  &mockDynamo{},
+		Command: "batch-get",
+		Table:   "testing",
+		Keys:    keys,
+		Output:  &bytes.Buffer{},
+	})
+	if err == nil || err.Error() != "Expected every key to have the attributes a, got b" {
+		t.Errorf("Expected an error for keys with different attributes, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// condition is the grammar for condition and filter expressions, for example:
+//
+//	attribute_not_exists(pk) or (version = 3 and size(tags) > 2)
+//	status in ("active", "pending") and not contains(tags, "broken")
+//
+// As in other statements, unquoted words on the right hand side of a
+// comparison are strings rather than attributes.
+type condition struct {
+	Or []*andCondition `@@ { "or" @@ }`
+}
+
+type andCondition struct {
+	And []*notCondition `@@ { "and" @@ }`
+}
+
+type notCondition struct {
+	Not     bool              `[ @"not" ]`
+	Operand *conditionOperand `@@`
+}
+
+type conditionOperand struct {
+	Group      *condition         `  "(" @@ ")"`
+	Function   *conditionFunction `| @@`
+	Comparison *comparison        `| @@`
+}
+
+type conditionFunction struct {
+	Name     string        `@( "attribute_exists" | "attribute_not_exists" | "attribute_type" | "begins_with" | "contains" ) "("`
+	Path     *documentPath `@@`
+	Argument *value        `[ "," @@ ] ")"`
+}
+
+type comparison struct {
+	Size     *documentPath `(  "size" "(" @@ ")"`
+	Path     *documentPath ` | @@ )`
+	Operator string        `(  @( "=" | "<" [ ">" | "=" ] | ">" [ "=" ] )`
+	Value    *value        `   @@`
+	Between  []*value      ` | "between" @@ "and" @@`
+	In       []*value      ` | "in" "(" @@ { "," @@ } ")" )`
+}
+
+func (c *condition) expression(e *expressionBuilder) string {
+	var conditions []string
+	for _, and := range c.Or {
+		conditions = append(conditions, and.expression(e))
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+func (a *andCondition) expression(e *expressionBuilder) string {
+	var conditions []string
+	for _, not := range a.And {
+		conditions = append(conditions, not.expression(e))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+func (n *notCondition) expression(e *expressionBuilder) string {
+	if n.Not {
+		return "NOT " + n.Operand.expression(e)
+	}
+	return n.Operand.expression(e)
+}
+
+func (o *conditionOperand) expression(e *expressionBuilder) string {
+	switch {
+	case o.Group != nil:
+		return "(" + o.Group.expression(e) + ")"
+	case o.Function != nil:
+		return o.Function.expression(e)
+	}
+	return o.Comparison.expression(e)
+}
+
+func (f *conditionFunction) expression(e *expressionBuilder) string {
+	name := strings.ToLower(f.Name)
+	takesArgument := name != "attribute_exists" && name != "attribute_not_exists"
+	if takesArgument && f.Argument == nil && e.err == nil {
+		e.err = validationErrorf("%s() takes a path and a value", name)
+	}
+	if !takesArgument && f.Argument != nil && e.err == nil {
+		e.err = validationErrorf("%s() only takes a path", name)
+	}
+	if f.Argument == nil {
+		return fmt.Sprintf("%s(%s)", name, f.Path.expression(e))
+	}
+	return fmt.Sprintf("%s(%s, %s)", name, f.Path.expression(e), e.literal(f.Argument))
+}
+
+func (c *comparison) expression(e *expressionBuilder) string {
+	operand := ""
+	if c.Size != nil {
+		operand = fmt.Sprintf("size(%s)", c.Size.expression(e))
+	} else {
+		operand = c.Path.expression(e)
+	}
+	switch {
+	case c.Between != nil:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", operand, e.literal(c.Between[0]), e.literal(c.Between[1]))
+	case c.In != nil:
+		var values []string
+		for _, v := range c.In {
+			values = append(values, e.literal(v))
+		}
+		return fmt.Sprintf("%s IN (%s)", operand, strings.Join(values, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", operand, c.Operator, e.literal(c.Value))
+}
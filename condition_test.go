@@ -0,0 +1,170 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func conditionSetup(statement string) (*condition, error) {
+	c := &condition{}
+	err := parseStatement(statement, c)
+	return c, err
+}
+
+func TestConditionExpressions(t *testing.T) {
+	tests := []struct {
+		statement  string
+		expression string
+	}{
+		{`attribute_not_exists(pk)`, "attribute_not_exists(#n0)"},
+		{`attribute_exists(a.b[2])`, "attribute_exists(#n0.#n1[2])"},
+		{`attribute_type(a, "S")`, "attribute_type(#n0, :v0)"},
+		{`begins_with(name, "Geo")`, "begins_with(#n0, :v0)"},
+		{`contains(tags, "x")`, "contains(#n0, :v0)"},
+		{`"Batting Avg" > 0.3 and attribute_exists(stats."Home Runs")`, "#n0 > :v0 AND attribute_exists(#n1.#n2)"},
+		{`version = 3`, "#n0 = :v0"},
+		{`version <> 3`, "#n0 <> :v0"},
+		{`version < 3`, "#n0 < :v0"},
+		{`version <= 3`, "#n0 <= :v0"},
+		{`version > 3`, "#n0 > :v0"},
+		{`version >= 3`, "#n0 >= :v0"},
+		{`size(tags) > 2`, "size(#n0) > :v0"},
+		{`size = 2`, "#n0 = :v0"},
+		{`deleted = false`, "#n0 = :v0"},
+		{`not attribute_exists(pk)`, "NOT attribute_exists(#n0)"},
+		{`a = 1 and b = 2 or c = 3`, "#n0 = :v0 AND #n1 = :v1 OR #n2 = :v2"},
+		{`a = 1 AND (b = 2 OR NOT c = 3)`, "#n0 = :v0 AND (#n1 = :v1 OR NOT #n2 = :v2)"},
+		{`status in ("active", "pending")`, "#n0 IN (:v0, :v1)"},
+		{`status IN (active)`, "#n0 IN (:v0)"},
+		{`age between 18 and 65`, "#n0 BETWEEN :v0 AND :v1"},
+		{`age between 18 and 65 and size(tags) <> 0`, "#n0 BETWEEN :v0 AND :v1 AND size(#n1) <> :v2"},
+	}
+	for _, test := range tests {
+		ast, err := conditionSetup(test.statement)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", test.statement, err)
+		}
+		expression := ast.expression(newExpressionBuilder())
+		if expression != test.expression {
+			t.Errorf("Expected expression for %s to be '%s', got '%s'", test.statement, test.expression, expression)
+		}
+	}
+}
+
+func TestParserConditionInvalid(t *testing.T) {
+	for _, statement := range []string{`version =`, `version == 3`, `attribute_exists(`, `(a = 1`, `a in ()`, `a between 1`} {
+		if _, err := conditionSetup(statement); err == nil {
+			t.Errorf("Expected an error parsing %s", statement)
+		}
+	}
+}
+
+func TestConditionFunctionArguments(t *testing.T) {
+	errors := map[string]string{
+		`attribute_exists(a, "x")`:   "attribute_exists() only takes a path",
+		`attribute_not_exists(a, 1)`: "attribute_not_exists() only takes a path",
+		`begins_with(a)`:             "begins_with() takes a path and a value",
+		`contains(a)`:                "contains() takes a path and a value",
+		`attribute_type(a)`:          "attribute_type() takes a path and a value",
+	}
+	for statement, expected := range errors {
+		ast, err := conditionSetup(statement)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", statement, err)
+		}
+		builder := newExpressionBuilder()
+		ast.expression(builder)
+		if _, ok := builder.err.(*validationError); !ok || builder.err.Error() != expected {
+			t.Errorf("Expected %s to fail with %s, got %v", statement, expected, builder.err)
+		}
+	}
+}
+
+func TestSetWithCondition(t *testing.T) {
+	client := &mockDynamo{}
+	c, err := conditionSetup(`attribute_not_exists(string) or version = 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := ddbArgs{
+		Client:  client,
+		Command: "set",
+		Arguments: &keyValue{
+			Attributes: []*attribute{
+				{
+					Key: "string",
+					Value: &value{
+						String: aws.String("bar"),
+					},
+				},
+			},
+		},
+		Condition: c,
+		Table:     "testing",
+	}
+	_, err = run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.putInput.ConditionExpression != "attribute_not_exists(#n0) OR #n1 = :v0" {
+		t.Errorf("Unexpected ConditionExpression '%s'", *client.putInput.ConditionExpression)
+	}
+	if *client.putInput.ExpressionAttributeNames["#n1"] != "version" {
+		t.Errorf("Expected #n1 to be 'version', got '%s'", *client.putInput.ExpressionAttributeNames["#n1"])
+	}
+}
+
+func TestSetWithoutCondition(t *testing.T) {
+	client := &mockDynamo{}
+	args := ddbArgs{
+		Client:  client,
+		Command: "set",
+		Arguments: &keyValue{
+			Attributes: []*attribute{
+				{
+					Key: "string",
+					Value: &value{
+						String: aws.String("bar"),
+					},
+				},
+			},
+		},
+		Table: "testing",
+	}
+	_, err := run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if client.putInput.ConditionExpression != nil {
+		t.Errorf("Expected no ConditionExpression, got '%s'", *client.putInput.ConditionExpression)
+	}
+	if client.putInput.ExpressionAttributeNames != nil {
+		t.Errorf("Expected no ExpressionAttributeNames")
+	}
+}
+
+func TestUpdateWithCondition(t *testing.T) {
+	client := &mockDynamo{}
+	statement, err := updateSetup(`key pk="a" set version=4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := conditionSetup(`version = 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(ddbArgs{
+		Client:    client,
+		Command:   "update",
+		Update:    statement,
+		Condition: c,
+		Table:     "testing",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.updateInput.ConditionExpression != "#n0 = :v1" {
+		t.Errorf("Unexpected ConditionExpression '%s'", *client.updateInput.ConditionExpression)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Exit codes, so that scripts can tell the kind of failure apart.
+const (
+	exitServiceError           = 1
+	exitUsage                  = 2
+	exitConditionalCheckFailed = 3
+	exitParse                  = 4
+	exitValidation             = 5
+	exitThrottled              = 6
+)
+
+// usageError is returned for missing or conflicting flags.
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
+
+// parseError is returned when a statement can't be parsed. It is shown with
+// the line of the statement that failed and a caret under the error, followed
+// by a hint for some common mistakes.
+type parseError struct {
+	statement string
+	pos       *lexer.Position
+	message   string
+	hint      string
+}
+
+func (e *parseError) Error() string {
+	var b strings.Builder
+	if e.pos == nil {
+		fmt.Fprintf(&b, "Invalid statement: %s\n  %s", e.message, strings.Replace(e.statement, "\n", "\n  ", -1))
+	} else {
+		line := statementLine(e.statement, e.pos.Line)
+		fmt.Fprintf(&b, "Invalid statement at line %d, column %d: %s\n  %s\n  ", e.pos.Line, e.pos.Column, e.message, line)
+		for _, r := range line[:columnOffset(line, e.pos.Column)] {
+			if r == '\t' {
+				b.WriteRune('\t')
+			} else {
+				b.WriteRune(' ')
+			}
+		}
+		b.WriteString("^")
+	}
+	if e.hint != "" {
+		b.WriteString("\n" + e.hint)
+	}
+	return b.String()
+}
+
+// capturePosition matches the position participle adds to errors returned by
+// Capture methods, such as an invalid number.
+var capturePosition = regexp.MustCompile(`^<source>:(\d+):(\d+): [\w.]+: `)
+
+// unquotedWords matches a key followed by an unquoted word and a space, as
+// the lexer reads the next word as another token.
+var unquotedWords = regexp.MustCompile(`(\w+)\s*=\s*([A-Za-z_]\w*)\s+$`)
+
+// missingComma matches another key=value pair where the lexer expected a
+// comma.
+var missingComma = regexp.MustCompile(`^\w+\s*=`)
+
+func newParseError(statement string, err error) *parseError {
+	e := &parseError{statement: statement, message: err.Error()}
+	if lexErr, ok := err.(*lexer.Error); ok {
+		pos := lexErr.Pos
+		if pos.Line == 0 {
+			// The end of the statement has no position.
+			pos = lexer.Position{Line: 1 + strings.Count(statement, "\n"), Column: utf8.RuneCountInString(statement[strings.LastIndex(statement, "\n")+1:]) + 1}
+		}
+		e.pos, e.message = &pos, lexErr.Message
+	}
+	if m := capturePosition.FindStringSubmatch(e.message); m != nil {
+		if e.pos == nil {
+			line, _ := strconv.Atoi(m[1])
+			column, _ := strconv.Atoi(m[2])
+			e.pos = &lexer.Position{Line: line, Column: column}
+		}
+		e.message = e.message[len(m[0]):]
+	}
+	e.message = strings.Replace(e.message, `"<EOF>"`, "end of statement", 1)
+	if e.pos != nil {
+		e.suggest()
+	}
+	return e
+}
+
+// suggest sets a hint for common mistakes, moving the caret to the start of
+// the mistake if the error is found later on.
+func (e *parseError) suggest() {
+	line := statementLine(e.statement, e.pos.Line)
+	offset := columnOffset(line, e.pos.Column)
+	before, rest := line[:offset], line[offset:]
+	switch {
+	case strings.Contains(e.message, "literal not terminated"):
+		if start := unterminatedQuote(line); start >= 0 {
+			e.pos.Column = utf8.RuneCountInString(line[:start]) + 1
+		}
+		e.hint = "The string is missing its closing quote"
+	case strings.Contains(e.message, "char literal") || strings.HasPrefix(rest, "'"):
+		e.hint = "Strings are quoted with double quotes"
+		start := offset
+		if !strings.HasPrefix(rest, "'") || strings.Count(before, "'")%2 == 1 {
+			// The lexer stops inside or at the end of the quoted text.
+			if start = strings.LastIndex(before, "'"); start < 0 {
+				break
+			}
+		}
+		e.pos.Column = utf8.RuneCountInString(line[:start]) + 1
+		if end := strings.Index(line[start+1:], "'"); end >= 0 {
+			e.hint += fmt.Sprintf(", such as %q", line[start+1:start+1+end])
+		}
+	case missingComma.MatchString(rest) && insideMap(before):
+		e.hint = "Map entries are written as key: value, such as map{name: \"x\"}"
+	case missingComma.MatchString(rest):
+		e.hint = "Attributes are separated by commas, such as a=1,b=2"
+	case unquotedWords.MatchString(before) && isWordStart(rest):
+		m := unquotedWords.FindStringSubmatchIndex(before)
+		words := line[m[4]:]
+		if end := strings.Index(words, ","); end >= 0 {
+			words = words[:end]
+		}
+		e.hint = fmt.Sprintf("Strings with spaces must be quoted, such as %s=%q", before[m[2]:m[3]], strings.TrimSpace(words))
+	case strings.HasPrefix(rest, ":"):
+		e.hint = "Attributes are written as key=value"
+	case strings.HasPrefix(rest, ",") && strings.TrimSpace(rest[1:]) == "":
+		e.hint = "Remove the trailing comma"
+	case strings.TrimSpace(rest) == "" && strings.HasSuffix(strings.TrimSpace(before), "="):
+		e.hint = "Expected a value after the ="
+	}
+}
+
+// statementLine returns the nth line of a statement, or the statement if it
+// is a single line from a file.
+func statementLine(statement string, n int) string {
+	lines := strings.Split(statement, "\n")
+	if n < 1 || n > len(lines) {
+		return lines[len(lines)-1]
+	}
+	return lines[n-1]
+}
+
+// columnOffset converts a column, counted in characters from 1, to an offset
+// in bytes.
+func columnOffset(line string, column int) int {
+	for offset := range line {
+		if column <= 1 {
+			return offset
+		}
+		column--
+	}
+	return len(line)
+}
+
+// unterminatedQuote returns the offset of the string that isn't closed, or
+// -1 if every string is closed.
+func unterminatedQuote(line string) int {
+	start := -1
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case start < 0:
+			if r == '"' || r == '`' {
+				start, quote = i, r
+			}
+		case escaped:
+			escaped = false
+		case r == '\\' && quote == '"':
+			escaped = true
+		case r == quote:
+			start = -1
+		}
+	}
+	return start
+}
+
+// insideMap reports whether text ends inside a map{...} literal.
+func insideMap(text string) bool {
+	start := strings.LastIndex(text, "map{")
+	return start >= 0 && strings.Count(text[start:], "{") > strings.Count(text[start:], "}")
+}
+
+func isWordStart(s string) bool {
+	if s == "" {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// validationError is returned when a statement parses but can't be sent to
+// DynamoDB, such as a set with mixed types.
+type validationError struct {
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+func validationErrorf(format string, args ...interface{}) error {
+	return &validationError{fmt.Sprintf(format, args...)}
+}
+
+// serviceError is an error returned by DynamoDB.
+type serviceError struct {
+	code    string
+	message string
+}
+
+func (e *serviceError) Error() string {
+	return fmt.Sprintf("%s: %s", e.code, e.message)
+}
+
+// throttlingError is returned when DynamoDB is still throttling requests
+// after the SDK has retried them.
+type throttlingError struct {
+	serviceError
+}
+
+// conditionFailedError is returned when a -condition is not met.
+type conditionFailedError struct {
+	condition string
+}
+
+func (e *conditionFailedError) Error() string {
+	return "Condition not met, nothing was written: " + e.condition
+}
+
+var throttlingCodes = map[string]bool{
+	dynamodb.ErrCodeProvisionedThroughputExceededException: true,
+	dynamodb.ErrCodeRequestLimitExceeded:                   true,
+	"ThrottlingException":                                  true,
+}
+
+// newServiceError converts errors from the SDK into a serviceError or
+// throttlingError. Other errors are returned unchanged. The message keeps
+// the details the SDK adds on later lines, such as the cause of a failed
+// request or which parameters are invalid, on one line.
+func newServiceError(err error) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimPrefix(aerr.Error(), aerr.Code()+": "), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	e := serviceError{code: aerr.Code(), message: strings.Join(lines, " ")}
+	if throttlingCodes[e.code] {
+		return &throttlingError{e}
+	}
+	return &e
+}
+
+// exitCode returns the exit code for an error returned by run.
+func exitCode(err error) int {
+	switch e := err.(type) {
+	case *usageError:
+		return exitUsage
+	case *parseError:
+		return exitParse
+	case *validationError:
+		return exitValidation
+	case *throttlingError:
+		return exitThrottled
+	case *conditionFailedError:
+		return exitConditionalCheckFailed
+	case *transactionCanceledError:
+		if e.conditionFailed() {
+			return exitConditionalCheckFailed
+		}
+	}
+	return exitServiceError
+}
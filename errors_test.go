@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestExitCode(t *testing.T) {
+	codes := map[error]int{
+		errors.New("network"):                                                          exitServiceError,
+		&serviceError{"ValidationException", "bad"}:                                    exitServiceError,
+		usageErrorf("-table is required"):                                              exitUsage,
+		&conditionFailedError{"attribute_exists(a)"}:                                   exitConditionalCheckFailed,
+		&parseError{statement: "a="}:                                                   exitParse,
+		validationErrorf("mixed set"):                                                  exitValidation,
+		&throttlingError{serviceError{"ThrottlingException", "slow down"}}:             exitThrottled,
+		&transactionCanceledError{reasons: []string{"None", "ConditionalCheckFailed"}}: exitConditionalCheckFailed,
+		&transactionCanceledError{reasons: []string{"None", "TransactionConflict"}}:    exitServiceError,
+	}
+	for err, expected := range codes {
+		if code := exitCode(err); code != expected {
+			t.Errorf("Expected %v to exit with %d, got %d", err, expected, code)
+		}
+	}
+}
+
+func TestNewServiceError(t *testing.T) {
+	err := newServiceError(awserr.New(dynamodb.ErrCodeResourceNotFoundException, "Requested resource not found", nil))
+	if _, ok := err.(*serviceError); !ok || err.Error() != "ResourceNotFoundException: Requested resource not found" {
+		t.Errorf("Expected a serviceError, got %#v", err)
+	}
+	err = newServiceError(awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "Rate exceeded", nil))
+	if _, ok := err.(*throttlingError); !ok || err.Error() != "ProvisionedThroughputExceededException: Rate exceeded" {
+		t.Errorf("Expected a throttlingError, got %#v", err)
+	}
+	err = newServiceError(awserr.New("RequestError", "send request failed", errors.New("dial tcp: connection refused")))
+	if err.Error() != "RequestError: send request failed caused by: dial tcp: connection refused" {
+		t.Errorf("Expected the cause of the error, got %s", err)
+	}
+	invalid := request.ErrInvalidParams{Context: "DescribeTableInput"}
+	invalid.Add(request.NewErrParamMinLen("TableName", 3))
+	err = newServiceError(invalid)
+	if err.Error() != "InvalidParameter: 1 validation error(s) found. - minimum field size of 3, DescribeTableInput.TableName." {
+		t.Errorf("Expected the invalid parameter, got %s", err)
+	}
+	other := errors.New("other")
+	if newServiceError(other) != other {
+		t.Errorf("Expected other errors to be returned unchanged")
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	statements := map[string]string{
+		`a="b",c=`: `Invalid statement at line 1, column 9: unexpected end of statement (expected (<float> | <int>))
+  a="b",c=
+          ^
+Expected a value after the =`,
+		`a="b,c=1`: `Invalid statement at line 1, column 3: literal not terminated
+  a="b,c=1
+    ^
+The string is missing its closing quote`,
+		`a=1 b=2`: `Invalid statement at line 1, column 5: unexpected trailing token "b"
+  a=1 b=2
+      ^
+Attributes are separated by commas, such as a=1,b=2`,
+		`title=Animal Farm,author="George Orwell"`: `Invalid statement at line 1, column 14: unexpected trailing token "Farm"
+  title=Animal Farm,author="George Orwell"
+               ^
+Strings with spaces must be quoted, such as title="Animal Farm"`,
+		`a="x",b='ab c'`: `Invalid statement at line 1, column 9: invalid char literal
+  a="x",b='ab c'
+          ^
+Strings are quoted with double quotes, such as "ab c"`,
+		`m=map{name="x"}`: `Invalid statement at line 1, column 7: unexpected "name" (expected "}")
+  m=map{name="x"}
+        ^
+Map entries are written as key: value, such as map{name: "x"}`,
+		`a:1`: `Invalid statement at line 1, column 2: unexpected ":" (expected "=")
+  a:1
+   ^
+Attributes are written as key=value`,
+		`a=1,`: `Invalid statement at line 1, column 4: unexpected trailing token ","
+  a=1,
+     ^
+Remove the trailing comma`,
+		`a=1,b=hex"0g"`: `Invalid statement at line 1, column 10: Invalid hex "0g": encoding/hex: invalid byte: U+0067 'g'
+  a=1,b=hex"0g"
+           ^`,
+		`a=[b64"SGVsbG8"]`: `Invalid statement at line 1, column 7: Invalid base64 "SGVsbG8": illegal base64 data at input byte 4
+  a=[b64"SGVsbG8"]
+        ^`,
+		"a=1,\n\tb=0x1F": `Invalid statement at line 2, column 4: Invalid number 0x1F, numbers must be written in decimal
+  	b=0x1F
+  	  ^`,
+	}
+	for statement, expected := range statements {
+		err := parseStatement(statement, &keyValue{})
+		if _, ok := err.(*parseError); !ok || err.Error() != expected {
+			t.Errorf("Expected %s to fail with\n%s\ngot\n%v", statement, expected, err)
+		}
+	}
+}
+
+func TestValueToAttributeMixedSet(t *testing.T) {
+	ast := &keyValue{}
+	if err := parseStatement(`a=("x", 1)`, ast); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	_, err := valueToAttribute(ast.Attributes[0].Value)
+	if _, ok := err.(*validationError); !ok {
+		t.Errorf("Expected a validationError, got %v", err)
+	}
+}
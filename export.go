@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// manifestName is the file in an export directory that describes the export.
+const manifestName = "manifest.json"
+
+// defaultItemsPerFile is how many items are written to each export file
+// before starting the next one.
+const defaultItemsPerFile = 100000
+
+var exportExtensions = map[string]string{
+	"jsonl":    ".jsonl",
+	"csv":      ".csv",
+	"ddb-json": ".json",
+}
+
+// exportManifest is written alongside the exported files, so that an export
+// can be checked and imported again with -command import -file <dir>.
+type exportManifest struct {
+	Table      string       `json:"table"`
+	Format     string       `json:"format"`
+	Compressed bool         `json:"compressed"`
+	ItemCount  int          `json:"itemCount"`
+	KeySchema  []exportKey  `json:"keySchema"`
+	Files      []exportFile `json:"files"`
+}
+
+type exportKey struct {
+	AttributeName string `json:"attributeName"`
+	KeyType       string `json:"keyType"`
+	AttributeType string `json:"attributeType"`
+}
+
+type exportFile struct {
+	Name      string `json:"name"`
+	ItemCount int    `json:"itemCount"`
+	SHA256    string `json:"sha256"`
+}
+
+// export scans the table into files in args.OutDir, starting a new file
+// every args.ItemsPerFile items, and then writes the manifest.
+func export(args ddbArgs) (string, error) {
+	format := args.FileFormat
+	if format == "" {
+		format = "jsonl"
+	}
+	if _, ok := exportExtensions[format]; !ok {
+		return "", fmt.Errorf("Unknown export format %s, expected jsonl, csv or ddb-json", format)
+	}
+	if _, err := os.Stat(filepath.Join(args.OutDir, manifestName)); err == nil {
+		return "", fmt.Errorf("%s already contains an export", args.OutDir)
+	}
+	if err := os.MkdirAll(args.OutDir, 0755); err != nil {
+		return "", err
+	}
+
+	table, err := args.Client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: &args.Table,
+	})
+	if err != nil {
+		return "", err
+	}
+	manifest := &exportManifest{
+		Table:      args.Table,
+		Format:     format,
+		Compressed: args.Gzip,
+		KeySchema:  keySchema(table.Table),
+	}
+
+	itemsPerFile := args.ItemsPerFile
+	if itemsPerFile < 1 {
+		itemsPerFile = defaultItemsPerFile
+	}
+	writer := &exportWriter{
+		dir:          args.OutDir,
+		manifest:     manifest,
+		itemsPerFile: itemsPerFile,
+	}
+	for _, key := range manifest.KeySchema {
+		writer.keys = append(writer.keys, key.AttributeName)
+	}
+	scanErr := scanInto(args, writer)
+	if err := writer.Close(); err != nil && scanErr == nil {
+		scanErr = err
+	}
+	if scanErr != nil {
+		return "", scanErr
+	}
+
+	m, err := json.MarshalIndent(manifest, "", "	")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(args.OutDir, manifestName), append(m, '\n'), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Exported %d items to %d files in %s", manifest.ItemCount, len(manifest.Files), args.OutDir), nil
+}
+
+// keySchema returns the partition key, and sort key if there is one, with
+// their attribute types.
+func keySchema(table *dynamodb.TableDescription) []exportKey {
+	return keyElements(table, table.KeySchema)
+}
+
+// keyElements returns the keys of a table or one of its indexes, with the
+// attribute types from the table's attribute definitions.
+func keyElements(table *dynamodb.TableDescription, elements []*dynamodb.KeySchemaElement) []exportKey {
+	types := map[string]string{}
+	for _, definition := range table.AttributeDefinitions {
+		types[aws.StringValue(definition.AttributeName)] = aws.StringValue(definition.AttributeType)
+	}
+	var keys []exportKey
+	for _, key := range elements {
+		name := aws.StringValue(key.AttributeName)
+		keys = append(keys, exportKey{
+			AttributeName: name,
+			KeyType:       aws.StringValue(key.KeyType),
+			AttributeType: types[name],
+		})
+	}
+	return keys
+}
+
+// exportWriter writes items to numbered files, recording each file in the
+// manifest once it is complete.
+type exportWriter struct {
+	dir          string
+	manifest     *exportManifest
+	itemsPerFile int
+	keys         []string
+	current      *exportPart
+}
+
+// exportPart is a single export file, hashed as it is written.
+type exportPart struct {
+	name   string
+	file   *os.File
+	hash   hash.Hash
+	gzip   *gzip.Writer
+	writer itemWriter
+	count  int
+}
+
+func (e *exportWriter) Write(items []map[string]*dynamodb.AttributeValue) error {
+	for len(items) > 0 {
+		if e.current == nil {
+			if err := e.open(); err != nil {
+				return err
+			}
+		}
+		n := e.itemsPerFile - e.current.count
+		if n > len(items) {
+			n = len(items)
+		}
+		if err := e.current.writer.Write(items[:n]); err != nil {
+			return err
+		}
+		e.current.count += n
+		e.manifest.ItemCount += n
+		items = items[n:]
+		if e.current.count == e.itemsPerFile {
+			if err := e.Close(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *exportWriter) open() error {
+	name := fmt.Sprintf("part-%05d%s", len(e.manifest.Files), exportExtensions[e.manifest.Format])
+	if e.manifest.Compressed {
+		name += ".gz"
+	}
+	file, err := os.Create(filepath.Join(e.dir, name))
+	if err != nil {
+		return err
+	}
+	part := &exportPart{name: name, file: file, hash: sha256.New()}
+	var w io.Writer = io.MultiWriter(file, part.hash)
+	if e.manifest.Compressed {
+		part.gzip = gzip.NewWriter(w)
+		w = part.gzip
+	}
+	if e.manifest.Format == "csv" {
+		part.writer = &csvItemWriter{w: w, keys: e.keys}
+	} else {
+		part.writer, err = newItemWriter(w, e.manifest.Format)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	e.current = part
+	return nil
+}
+
+// Close finishes the current file, if there is one.
+func (e *exportWriter) Close() error {
+	part := e.current
+	if part == nil {
+		return nil
+	}
+	e.current = nil
+	err := part.writer.Close()
+	if part.gzip != nil {
+		if gzipErr := part.gzip.Close(); err == nil {
+			err = gzipErr
+		}
+	}
+	if closeErr := part.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	e.manifest.Files = append(e.manifest.Files, exportFile{
+		Name:      part.name,
+		ItemCount: part.count,
+		SHA256:    hex.EncodeToString(part.hash.Sum(nil)),
+	})
+	return nil
+}
+
+// csvItemWriter writes items as CSV with a typed header row that can be read
+// by import. The header needs every attribute, so items are held in memory
+// until the writer is closed. Key attributes come first, followed by the
+// other attributes in alphabetical order. Empty strings and binary are
+// refused, as import reads empty cells as missing attributes.
+type csvItemWriter struct {
+	w     io.Writer
+	keys  []string
+	items []map[string]*dynamodb.AttributeValue
+}
+
+func (c *csvItemWriter) Write(items []map[string]*dynamodb.AttributeValue) error {
+	c.items = append(c.items, items...)
+	return nil
+}
+
+func (c *csvItemWriter) Close() error {
+	types := map[string]string{}
+	nulls := map[string]bool{}
+	for _, item := range c.items {
+		for name, av := range item {
+			t := attributeType(av)
+			if (av.S != nil && *av.S == "") || (av.B != nil && len(av.B) == 0) {
+				return fmt.Errorf("Attribute %s has an empty %s value, which can't be told apart from a missing attribute in CSV. Use -format ddb-json instead", name, t)
+			}
+			if nested := nestedNonJSON(av); nested != "" {
+				return fmt.Errorf("Attribute %s has %s values nested in %s, which are read back as JSON lists or strings from CSV. Use -format ddb-json instead", name, nested, t)
+			}
+			if t == "NULL" {
+				// The column's type comes from its other values, if any.
+				if _, ok := types[name]; !ok {
+					types[name] = ""
+				}
+				nulls[name] = true
+				continue
+			}
+			if existing := types[name]; existing != "" && existing != t {
+				return fmt.Errorf("Attribute %s has both %s and %s values, which can't be written to one CSV column. Use -format ddb-json instead", name, existing, t)
+			}
+			types[name] = t
+		}
+	}
+	columns := append([]string{}, c.keys...)
+	var others []string
+	for name := range types {
+		if !contains(c.keys, name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	columns = append(columns, others...)
+	for _, name := range columns {
+		if nulls[name] && types[name] == "S" {
+			return fmt.Errorf("Attribute %s has both S and NULL values, and a NULL string can't be told apart from a missing one in CSV. Use -format ddb-json instead", name)
+		}
+	}
+
+	buffered := bufio.NewWriter(c.w)
+	w := csv.NewWriter(buffered)
+	header := make([]string, len(columns))
+	for i, name := range columns {
+		t := types[name]
+		if t == "" {
+			t = "NULL"
+		}
+		header[i] = name + ":" + t
+	}
+	w.Write(header)
+	for _, item := range c.items {
+		record := make([]string, len(columns))
+		for i, name := range columns {
+			cell, err := attributeToCSV(item[name])
+			if err != nil {
+				return err
+			}
+			if av := item[name]; av != nil && av.NULL != nil {
+				cell = "null"
+			}
+			record[i] = cell
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// nestedNonJSON returns the type of the first set or binary value inside a
+// list or map, which plain JSON can't tell apart from a list or string.
+func nestedNonJSON(av *dynamodb.AttributeValue) string {
+	var nested []*dynamodb.AttributeValue
+	nested = append(nested, av.L...)
+	for _, v := range av.M {
+		nested = append(nested, v)
+	}
+	for _, v := range nested {
+		switch t := attributeType(v); t {
+		case "B", "SS", "NS", "BS":
+			return t
+		}
+		if t := nestedNonJSON(v); t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeToCSV is the reverse of csvCellToAttribute. Missing and NULL
+// attributes are written as empty cells, although csvItemWriter writes NULL
+// as null, as it only allows NULL in columns that aren't strings.
+func attributeToCSV(av *dynamodb.AttributeValue) (string, error) {
+	switch {
+	case av == nil || av.NULL != nil:
+		return "", nil
+	case av.S != nil:
+		return *av.S, nil
+	case av.N != nil:
+		return *av.N, nil
+	case av.BOOL != nil:
+		return fmt.Sprint(*av.BOOL), nil
+	case av.B != nil:
+		return base64.StdEncoding.EncodeToString(av.B), nil
+	}
+	r, err := json.Marshal(attributeToJSON(av))
+	return string(r), err
+}
+
+// attributeType returns the DynamoDB type of a value, such as S or NS.
+func attributeType(av *dynamodb.AttributeValue) string {
+	switch {
+	case av.S != nil:
+		return "S"
+	case av.N != nil:
+		return "N"
+	case av.BOOL != nil:
+		return "BOOL"
+	case av.B != nil:
+		return "B"
+	case av.SS != nil:
+		return "SS"
+	case av.NS != nil:
+		return "NS"
+	case av.BS != nil:
+		return "BS"
+	case av.L != nil:
+		return "L"
+	case av.M != nil:
+		return "M"
+	}
+	return "NULL"
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DescribeTable describes every table with the partition key "string",
+// except authors, which also has the sort key "published", a global index
+// by-title with only its keys, and a local index by-rating.
+func (d *mockDynamo) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	d.describes++
+	table := &dynamodb.TableDescription{
+		TableName: input.TableName,
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("string"), AttributeType: aws.String("S")},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("string"), KeyType: aws.String("HASH")},
+		},
+	}
+	if *input.TableName == "authors" {
+		table.AttributeDefinitions = []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("author"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("published"), AttributeType: aws.String("N")},
+			{AttributeName: aws.String("title"), AttributeType: aws.String("S")},
+			{AttributeName: aws.String("rating"), AttributeType: aws.String("N")},
+		}
+		table.KeySchema = []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("author"), KeyType: aws.String("HASH")},
+			{AttributeName: aws.String("published"), KeyType: aws.String("RANGE")},
+		}
+		table.GlobalSecondaryIndexes = []*dynamodb.GlobalSecondaryIndexDescription{{
+			IndexName:  aws.String("by-title"),
+			KeySchema:  []*dynamodb.KeySchemaElement{{AttributeName: aws.String("title"), KeyType: aws.String("HASH")}},
+			Projection: &dynamodb.Projection{ProjectionType: aws.String("KEYS_ONLY")},
+		}}
+		table.LocalSecondaryIndexes = []*dynamodb.LocalSecondaryIndexDescription{{
+			IndexName: aws.String("by-rating"),
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{AttributeName: aws.String("author"), KeyType: aws.String("HASH")},
+				{AttributeName: aws.String("rating"), KeyType: aws.String("RANGE")},
+			},
+			Projection: &dynamodb.Projection{ProjectionType: aws.String("KEYS_ONLY")},
+		}}
+	}
+	return &dynamodb.DescribeTableOutput{Table: table}, nil
+}
+
+func exportSetup(t *testing.T, format string, gzip bool, itemsPerFile int) (string, *exportManifest) {
+	dir, err := ioutil.TempDir("", "ddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "export")
+	result, err := run(ddbArgs{
+		Client:       &mockDynamo{},
+		Command:      "export",
+		Table:        "testing",
+		OutDir:       out,
+		FileFormat:   format,
+		Gzip:         gzip,
+		ItemsPerFile: itemsPerFile,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if !strings.HasPrefix(result, "Exported 2 items") {
+		t.Errorf("Expected 2 items to be exported, got %s", result)
+	}
+	m, err := ioutil.ReadFile(filepath.Join(out, manifestName))
+	if err != nil {
+		t.Fatalf("Expected a manifest, but got %s", err)
+	}
+	manifest := &exportManifest{}
+	if err := json.Unmarshal(m, manifest); err != nil {
+		t.Fatalf("Expected the manifest to be JSON, but got %s", err)
+	}
+	return out, manifest
+}
+
+func TestExport(t *testing.T) {
+	out, manifest := exportSetup(t, "", false, 0)
+	defer os.RemoveAll(filepath.Dir(out))
+	if manifest.Table != "testing" || manifest.Format != "jsonl" || manifest.ItemCount != 2 {
+		t.Errorf("Expected the manifest to describe the export, got %+v", manifest)
+	}
+	expectedKeys := []exportKey{{AttributeName: "string", KeyType: "HASH", AttributeType: "S"}}
+	if len(manifest.KeySchema) != 1 || manifest.KeySchema[0] != expectedKeys[0] {
+		t.Errorf("Expected key schema %v, got %v", expectedKeys, manifest.KeySchema)
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Name != "part-00000.jsonl" {
+		t.Fatalf("Expected one file, got %v", manifest.Files)
+	}
+	contents, _ := ioutil.ReadFile(filepath.Join(out, manifest.Files[0].Name))
+	expected := `{"string":"foo"}
+{"string":"bar"}
+`
+	if string(contents) != expected {
+		t.Errorf("Expected %s, got %s", expected, contents)
+	}
+	sum := sha256.Sum256(contents)
+	if manifest.Files[0].SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected the checksum of the file, got %s", manifest.Files[0].SHA256)
+	}
+}
+
+func TestExportRotatesCompressedFiles(t *testing.T) {
+	out, manifest := exportSetup(t, "ddb-json", true, 1)
+	defer os.RemoveAll(filepath.Dir(out))
+	expected := []string{`{"string":{"S":"foo"}}`, `{"string":{"S":"bar"}}`}
+	if len(manifest.Files) != len(expected) {
+		t.Fatalf("Expected %d files, got %v", len(expected), manifest.Files)
+	}
+	for i, file := range manifest.Files {
+		if file.Name != []string{"part-00000.json.gz", "part-00001.json.gz"}[i] || file.ItemCount != 1 {
+			t.Errorf("Expected file %d to be named in order with one item, got %+v", i, file)
+		}
+		contents, _ := ioutil.ReadFile(filepath.Join(out, file.Name))
+		sum := sha256.Sum256(contents)
+		if file.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("Expected the checksum of the compressed file, got %s", file.SHA256)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			t.Fatalf("Expected a gzip file, but got %s", err)
+		}
+		uncompressed, _ := ioutil.ReadAll(gz)
+		if strings.TrimSpace(string(uncompressed)) != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], uncompressed)
+		}
+	}
+}
+
+func TestExportRefusesExistingExport(t *testing.T) {
+	out, _ := exportSetup(t, "", false, 0)
+	defer os.RemoveAll(filepath.Dir(out))
+	_, err := run(ddbArgs{
+		Client:  &mockDynamo{},
+		Command: "export",
+		Table:   "testing",
+		OutDir:  out,
+	})
+	if err == nil || !strings.Contains(err.Error(), "already contains an export") {
+		t.Errorf("Expected an error, got %v", err)
+	}
+}
+
+func TestExportReimport(t *testing.T) {
+	out, _ := exportSetup(t, "csv", true, 1)
+	defer os.RemoveAll(filepath.Dir(out))
+	client := &mockDynamo{}
+	result, err := run(ddbArgs{
+		Client:  client,
+		Command: "import",
+		Table:   "testing",
+		File:    out,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result != "2 items written, 0 failed" {
+		t.Errorf("Expected 2 items written, got %s", result)
+	}
+	if len(client.batchWrites) != 1 {
+		t.Fatalf("Expected items from both files in one batch, got %d batches", len(client.batchWrites))
+	}
+	requests := client.batchWrites[0].RequestItems["testing"]
+	if *requests[0].PutRequest.Item["string"].S != "foo" || *requests[1].PutRequest.Item["string"].S != "bar" {
+		t.Errorf("Expected the exported items, got %v", requests)
+	}
+}
+
+func TestCSVItemWriter(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer := &csvItemWriter{w: output, keys: []string{"pk"}}
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{
+			"pk":   {S: aws.String("a")},
+			"n":    {N: aws.String("1.50")},
+			"tags": {SS: []*string{aws.String("x"), aws.String("y,z")}},
+			"data": {B: []byte("hello")},
+		},
+		{
+			"pk":   {S: aws.String("b")},
+			"ok":   {BOOL: aws.Bool(false)},
+			"meta": {M: map[string]*dynamodb.AttributeValue{"n": {N: aws.String("1")}}},
+			"n":    {NULL: aws.Bool(true)},
+			"gone": {NULL: aws.Bool(true)},
+		},
+	})
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expected := `pk:S,data:B,gone:NULL,meta:M,n:N,ok:BOOL,tags:SS
+a,aGVsbG8=,,,1.50,,"[""x"",""y,z""]"
+b,,null,"{""n"":1}",null,false,
+`
+	if output.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, output)
+	}
+}
+
+func TestCSVItemWriterNullString(t *testing.T) {
+	writer := &csvItemWriter{w: &bytes.Buffer{}, keys: []string{"pk"}}
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{"pk": {S: aws.String("a")}, "name": {S: aws.String("x")}},
+		{"pk": {S: aws.String("b")}, "name": {NULL: aws.Bool(true)}},
+	})
+	err := writer.Close()
+	if err == nil || !strings.Contains(err.Error(), "Attribute name has both S and NULL values") {
+		t.Errorf("Expected NULL in a string column to be refused, got %v", err)
+	}
+}
+
+func TestCSVItemWriterEmptyString(t *testing.T) {
+	writer := &csvItemWriter{w: &bytes.Buffer{}, keys: []string{"pk"}}
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{"pk": {S: aws.String("a")}, "note": {S: aws.String("")}},
+	})
+	err := writer.Close()
+	if err == nil || !strings.Contains(err.Error(), "Attribute note has an empty S value") {
+		t.Errorf("Expected an empty string to be refused, got %v", err)
+	}
+}
+
+func TestCSVItemWriterNestedTypes(t *testing.T) {
+	writer := &csvItemWriter{w: &bytes.Buffer{}, keys: []string{"pk"}}
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{"pk": {S: aws.String("a")}, "meta": {M: map[string]*dynamodb.AttributeValue{
+			"list": {L: []*dynamodb.AttributeValue{{SS: []*string{aws.String("x")}}}},
+		}}},
+	})
+	err := writer.Close()
+	if err == nil || !strings.Contains(err.Error(), "Attribute meta has SS values nested in M") {
+		t.Errorf("Expected a nested set to be refused, got %v", err)
+	}
+
+	output := &bytes.Buffer{}
+	writer = &csvItemWriter{w: output, keys: []string{"pk"}}
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{"pk": {S: aws.String("a")}, "list": {L: []*dynamodb.AttributeValue{{NULL: aws.Bool(true)}, {N: aws.String("1")}}}},
+	})
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	reader, err := newCSVReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := reader.Read()
+	if err != nil || item["list"].L[0].NULL == nil || *item["list"].L[1].N != "1" {
+		t.Errorf("Expected a nested NULL to be read back, got %s (%v)", item, err)
+	}
+}
+
+func TestCSVItemWriterMixedTypes(t *testing.T) {
+	writer := &csvItemWriter{w: &bytes.Buffer{}}
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{"n": {N: aws.String("1")}},
+		{"n": {S: aws.String("one")}},
+	})
+	err := writer.Close()
+	if err == nil || !strings.Contains(err.Error(), "Attribute n has both N and S values") {
+		t.Errorf("Expected a mixed type error, got %v", err)
+	}
+}
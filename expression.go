@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// documentPath is a reference to an attribute within an item, such as
+// a.b[0].c. Every attribute name in the path is replaced with a placeholder so
+// that reserved words can be used as attribute names, and names that aren't
+// words, such as "Batting Avg", are quoted.
+type documentPath struct {
+	Name     string         `@(Ident|String)`
+	Elements []*pathElement `{ @@ }`
+}
+
+type pathElement struct {
+	Attribute *string `  "." @(Ident|String)`
+	Index     *int    `| "[" @Int "]"`
+}
+
+func (p *documentPath) expression(e *expressionBuilder) string {
+	expression := e.name(p.Name)
+	for _, element := range p.Elements {
+		if element.Attribute != nil {
+			expression += "." + e.name(*element.Attribute)
+		} else {
+			expression += fmt.Sprintf("[%d]", *element.Index)
+		}
+	}
+	return expression
+}
+
+// projection is the grammar for projection expressions, a comma separated
+// list of document paths such as: a, b.c, list[0]
+type projection struct {
+	Paths []*documentPath `@@ { "," @@ }`
+}
+
+func (p *projection) expression(e *expressionBuilder) string {
+	var paths []string
+	for _, path := range p.Paths {
+		paths = append(paths, path.expression(e))
+	}
+	return strings.Join(paths, ", ")
+}
+
+// includes reports whether the whole of a top level attribute is projected.
+func (p *projection) includes(name string) bool {
+	for _, path := range p.Paths {
+		if path.Name == name && len(path.Elements) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// expressionBuilder hands out placeholder names and values for DynamoDB
+// expressions, so that attribute names never clash with reserved words and
+// literal values never need to be escaped. A single builder should be shared
+// by every expression in a request, as they share the same placeholder maps.
+type expressionBuilder struct {
+	names      map[string]*string
+	nameIndex  map[string]string
+	values     map[string]*dynamodb.AttributeValue
+	valueCount int
+	err        error
+}
+
+func newExpressionBuilder() *expressionBuilder {
+	return &expressionBuilder{
+		names:     map[string]*string{},
+		nameIndex: map[string]string{},
+		values:    map[string]*dynamodb.AttributeValue{},
+	}
+}
+
+// name returns the placeholder for an attribute name, reusing the same
+// placeholder if the name has been seen before.
+func (e *expressionBuilder) name(attributeName string) string {
+	if placeholder, ok := e.nameIndex[attributeName]; ok {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("#n%d", len(e.nameIndex))
+	n := attributeName
+	e.names[placeholder] = &n
+	e.nameIndex[attributeName] = placeholder
+	return placeholder
+}
+
+// value returns a new placeholder for an attribute value.
+func (e *expressionBuilder) value(av *dynamodb.AttributeValue) string {
+	placeholder := fmt.Sprintf(":v%d", e.valueCount)
+	e.valueCount++
+	e.values[placeholder] = av
+	return placeholder
+}
+
+// literal returns a new placeholder for a value in a statement. If the value
+// can't be converted, the first error is kept in e.err, which should be
+// checked once the expression has been built.
+func (e *expressionBuilder) literal(v *value) string {
+	av, err := valueToAttribute(v)
+	if err != nil && e.err == nil {
+		e.err = err
+	}
+	return e.value(av)
+}
+
+// attributeNames returns the ExpressionAttributeNames for the request, or nil
+// if no names were used. DynamoDB rejects empty maps.
+func (e *expressionBuilder) attributeNames() map[string]*string {
+	if len(e.names) == 0 {
+		return nil
+	}
+	return e.names
+}
+
+// attributeValues returns the ExpressionAttributeValues for the request, or
+// nil if no values were used.
+func (e *expressionBuilder) attributeValues() map[string]*dynamodb.AttributeValue {
+	if len(e.values) == 0 {
+		return nil
+	}
+	return e.values
+}
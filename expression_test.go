@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestProjectionExpressions(t *testing.T) {
+	tests := []struct {
+		statement  string
+		expression string
+		names      []string
+	}{
+		{`a`, "#n0", []string{"a"}},
+		{`a, b.c, list[0]`, "#n0, #n1.#n2, #n3[0]", []string{"a", "b", "c", "list"}},
+		{`name, size, comment`, "#n0, #n1, #n2", []string{"name", "size", "comment"}},
+		{`a.b[1][2].c, a.c`, "#n0.#n1[1][2].#n2, #n0.#n2", []string{"a", "b", "c"}},
+		{`"Batting Avg", stats."Home Runs"[0]`, "#n0, #n1.#n2[0]", []string{"Batting Avg", "stats", "Home Runs"}},
+	}
+	for _, test := range tests {
+		ast := &projection{}
+		if err := parseStatement(test.statement, ast); err != nil {
+			t.Fatalf("Error parsing %s: %s", test.statement, err)
+		}
+		builder := newExpressionBuilder()
+		expression := ast.expression(builder)
+		if expression != test.expression {
+			t.Errorf("Expected expression for %s to be '%s', got '%s'", test.statement, test.expression, expression)
+		}
+		names := builder.attributeNames()
+		if len(names) != len(test.names) {
+			t.Errorf("Expected %d attribute names for %s, got %d", len(test.names), test.statement, len(names))
+		}
+		for i, name := range test.names {
+			placeholder := builder.name(name)
+			if placeholder != fmt.Sprintf("#n%d", i) {
+				t.Errorf("Expected %s to have placeholder #n%d, got %s", name, i, placeholder)
+			}
+		}
+	}
+}
+
+func TestProjectionInvalid(t *testing.T) {
+	for _, statement := range []string{`a,`, `a.`, `a[b]`, `[0]`} {
+		if err := parseStatement(statement, &projection{}); err == nil {
+			t.Errorf("Expected an error parsing %s", statement)
+		}
+	}
+}
+
+func TestExpressionBuilderEmpty(t *testing.T) {
+	builder := newExpressionBuilder()
+	if builder.attributeNames() != nil {
+		t.Error("Expected no attribute names")
+	}
+	if builder.attributeValues() != nil {
+		t.Error("Expected no attribute values")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// clock and random are used by the built-in functions, and replaced in tests.
+var clock = time.Now
+var random io.Reader = rand.Reader
+
+// function is a built-in function in a statement, such as now() or uuid(),
+// which is called when the statement is converted to attribute values.
+type function struct {
+	Name      string   `@( "now":Ident | "ttl":Ident | "uuid":Ident | "ulid":Ident | "env":Ident | "file":Ident ) "("`
+	Arguments []*value `[ @@ { "," @@ } ] ")"`
+}
+
+// name is the function's name in lower case, as names are case insensitive.
+func (f *function) name() string {
+	return strings.ToLower(f.Name)
+}
+
+// attributeType is the type the function returns, so that keys can be checked
+// without calling it.
+func (f *function) attributeType() string {
+	switch f.name() {
+	case "now":
+		if len(f.Arguments) == 1 && f.Arguments[0].String != nil && strings.EqualFold(*f.Arguments[0].String, "iso") {
+			return dynamodb.ScalarAttributeTypeS
+		}
+		return dynamodb.ScalarAttributeTypeN
+	case "ttl":
+		return dynamodb.ScalarAttributeTypeN
+	}
+	return dynamodb.ScalarAttributeTypeS
+}
+
+func (f *function) call() (*dynamodb.AttributeValue, error) {
+	switch f.name() {
+	case "now":
+		format := "epoch"
+		if len(f.Arguments) > 0 {
+			s, err := f.stringArgument()
+			if err != nil {
+				return nil, err
+			}
+			format = strings.ToLower(s)
+		}
+		t := clock()
+		switch format {
+		case "epoch":
+			return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.Unix(), 10))}, nil
+		case "ms":
+			return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))}, nil
+		case "iso":
+			return &dynamodb.AttributeValue{S: aws.String(t.UTC().Format(time.RFC3339))}, nil
+		}
+		return nil, validationErrorf("Unknown now() format %s, expected epoch, ms or iso", format)
+	case "ttl":
+		if len(f.Arguments) != 1 {
+			return nil, validationErrorf("ttl() takes a duration, such as ttl(\"7d\")")
+		}
+		d, err := ttlDuration(f.Arguments[0])
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(clock().Add(d).Unix(), 10))}, nil
+	case "uuid":
+		if err := f.noArguments(); err != nil {
+			return nil, err
+		}
+		b := make([]byte, 16)
+		if _, err := io.ReadFull(random, b); err != nil {
+			return nil, err
+		}
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return &dynamodb.AttributeValue{S: aws.String(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))}, nil
+	case "ulid":
+		if err := f.noArguments(); err != nil {
+			return nil, err
+		}
+		id, err := newULID(clock())
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{S: aws.String(id)}, nil
+	case "env":
+		name, err := f.stringArgument()
+		if err != nil {
+			return nil, err
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, validationErrorf("The environment variable %s is not set", name)
+		}
+		return &dynamodb.AttributeValue{S: aws.String(v)}, nil
+	case "file":
+		name, err := f.stringArgument()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, validationErrorf("Error reading file: %s", err)
+		}
+		if !utf8.Valid(raw) {
+			return nil, validationErrorf("%s isn't UTF-8 text, read it as binary with {%q} instead", name, name)
+		}
+		return &dynamodb.AttributeValue{S: aws.String(string(raw))}, nil
+	}
+	return nil, validationErrorf("Unknown function %s()", f.Name)
+}
+
+func (f *function) noArguments() error {
+	if len(f.Arguments) != 0 {
+		return validationErrorf("%s() doesn't take any arguments", f.name())
+	}
+	return nil
+}
+
+// stringArgument returns the function's only argument, which must be a
+// string.
+func (f *function) stringArgument() (string, error) {
+	if len(f.Arguments) != 1 {
+		return "", validationErrorf("%s() takes one string argument", f.name())
+	}
+	av, err := valueToAttribute(f.Arguments[0])
+	if err != nil {
+		return "", err
+	}
+	if av.S == nil {
+		return "", validationErrorf("%s() takes a string, got %s", f.name(), attributeType(av))
+	}
+	return *av.S, nil
+}
+
+var ttlPart = regexp.MustCompile(`(\d+)([wdhms])`)
+
+var ttlUnits = map[string]time.Duration{
+	"w": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+	"s": time.Second,
+}
+
+// ttlDuration reads a duration such as "7d" or "1d12h", or a number of
+// seconds.
+func ttlDuration(v *value) (time.Duration, error) {
+	av, err := valueToAttribute(v)
+	if err != nil {
+		return 0, err
+	}
+	if av.N != nil {
+		seconds, err := strconv.ParseInt(*av.N, 10, 64)
+		if err != nil {
+			return 0, validationErrorf("ttl() takes a whole number of seconds, got %s", *av.N)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	if av.S == nil {
+		return 0, validationErrorf("ttl() takes a duration, such as ttl(\"7d\"), got %s", attributeType(av))
+	}
+	s := strings.ToLower(*av.S)
+	parts := ttlPart.FindAllStringSubmatch(s, -1)
+	if len(parts) == 0 || strings.Join(ttlPart.FindAllString(s, -1), "") != s {
+		return 0, validationErrorf("Invalid duration %q, expected a number of weeks, days, hours, minutes or seconds, such as 7d or 1d12h", *av.S)
+	}
+	var d time.Duration
+	for _, part := range parts {
+		n, _ := strconv.ParseInt(part[1], 10, 64)
+		d += time.Duration(n) * ttlUnits[part[2]]
+	}
+	return d, nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID, a 48 bit millisecond timestamp followed by 80
+// random bits, written as 26 characters of Crockford's base32.
+func newULID(t time.Time) (string, error) {
+	b := make([]byte, 16)
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+	if _, err := io.ReadFull(random, b[6:]); err != nil {
+		return "", err
+	}
+	n := new(big.Int).SetBytes(b)
+	id := make([]byte, 26)
+	for i := len(id) - 1; i >= 0; i-- {
+		id[i] = crockford[n.Uint64()&31]
+		n.Rsh(n, 5)
+	}
+	return string(id), nil
+}
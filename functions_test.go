@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// functionSetup fixes the clock at 2024-05-01T10:00:00Z and the random bytes
+// to 0, 1, 2..., until the returned function is called.
+func functionSetup() func() {
+	oldClock, oldRandom := clock, random
+	clock = func() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+	random = bytes.NewReader([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	return func() { clock, random = oldClock, oldRandom }
+}
+
+func TestFunctions(t *testing.T) {
+	defer functionSetup()()
+	os.Setenv("DDB_TEST_ENV", "from env")
+	defer os.Unsetenv("DDB_TEST_ENV")
+	dir, err := ioutil.TempDir("", "ddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	text := filepath.Join(dir, "text.txt")
+	ioutil.WriteFile(text, []byte("from file"), 0644)
+
+	expected := map[string]string{
+		`now()`:                "1714557600",
+		`now("ms")`:            "1714557600000",
+		`NOW("iso")`:           "2024-05-01T10:00:00Z",
+		`ttl("7d")`:            "1715162400",
+		`ttl("1d12h")`:         "1714687200",
+		`ttl(60)`:              "1714557660",
+		`uuid()`:               "00010203-0405-4607-8809-0a0b0c0d0e0f",
+		`env("DDB_TEST_ENV")`:  "from env",
+		`file("` + text + `")`: "from file",
+		`S(now())`:             "1714557600",
+	}
+	for function, result := range expected {
+		ast := &keyValue{}
+		if err := parseStatement("a="+function, ast); err != nil {
+			t.Fatal(err)
+		}
+		av, err := valueToAttribute(ast.Attributes[0].Value)
+		if err != nil {
+			t.Fatalf("Expected %s to succeed, but got %s", function, err)
+		}
+		s := av.S
+		if av.N != nil {
+			s = av.N
+		}
+		if s == nil || *s != result {
+			t.Errorf("Expected %s to return %s, got %s", function, result, av)
+		}
+	}
+}
+
+func TestULID(t *testing.T) {
+	defer functionSetup()()
+	random = bytes.NewReader([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	id, err := newULID(clock())
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if id != "01HWSSHG80000G40R40M30E209" {
+		t.Errorf("Expected a ULID of the time and random bytes, got %s", id)
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	defer functionSetup()()
+	errors := map[string]string{
+		`now("x")`:              "Unknown now() format x, expected epoch, ms or iso",
+		`ttl("7 days")`:         `Invalid duration "7 days", expected a number of weeks, days, hours, minutes or seconds, such as 7d or 1d12h`,
+		`ttl(1.5)`:              "ttl() takes a whole number of seconds, got 1.5",
+		`uuid(1)`:               "uuid() doesn't take any arguments",
+		`env(1)`:                "env() takes a string, got N",
+		`env("DDB_TEST_UNSET")`: "The environment variable DDB_TEST_UNSET is not set",
+		`file()`:                "file() takes one string argument",
+	}
+	for function, expected := range errors {
+		ast := &keyValue{}
+		if err := parseStatement("a="+function, ast); err != nil {
+			t.Fatal(err)
+		}
+		_, err := valueToAttribute(ast.Attributes[0].Value)
+		if _, ok := err.(*validationError); !ok || err.Error() != expected {
+			t.Errorf("Expected %s to fail with %s, got %v", function, expected, err)
+		}
+	}
+}
+
+func TestFunctionInUpdate(t *testing.T) {
+	defer functionSetup()()
+	ast, err := updateSetup(`key pk="a" set expires=ttl("1h"), ttl=ttl + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	if expression != "SET #n0 = :v0, #n1 = #n1 + :v1" {
+		t.Errorf("Expected ttl on its own to be an attribute, got %s", expression)
+	}
+	if values := builder.attributeValues(); *values[":v0"].N != "1714561200" {
+		t.Errorf("Expected the TTL to be an hour from now, got %s", values)
+	}
+}
+
+func TestFunctionsInSets(t *testing.T) {
+	defer functionSetup()()
+	random = bytes.NewReader(make([]byte, 32))
+	ast := &keyValue{}
+	if err := parseStatement(`ids=(uuid(), ulid()),strings=(S(1), S(2)),numbers=(N("1"), 2),mixed=(now(), "x")`, ast); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := valueToAttribute(ast.Attributes[0].Value)
+	if err != nil || len(ids.SS) != 2 {
+		t.Errorf("Expected a string set of IDs, got %s (%v)", ids, err)
+	}
+	casts, err := valueToAttribute(ast.Attributes[1].Value)
+	if err != nil || len(casts.SS) != 2 || *casts.SS[0] != "1" {
+		t.Errorf("Expected a string set of casts, got %s (%v)", casts, err)
+	}
+	numbers, err := valueToAttribute(ast.Attributes[2].Value)
+	if err != nil || len(numbers.NS) != 2 {
+		t.Errorf("Expected a number set, got %s (%v)", numbers, err)
+	}
+	if _, err := valueToAttribute(ast.Attributes[3].Value); err == nil {
+		t.Errorf("Expected a set of a number and a string to be refused")
+	}
+}
@@ -1,6 +1,18 @@
 module github.com/patrobinson/ddb
 
+go 1.27.1
+
 require (
 	github.com/alecthomas/participle v0.2.0
 	github.com/aws/aws-sdk-go v1.16.18
+	github.com/peterh/liner v1.2.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/mattn/go-runewidth v0.0.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/testify v1.2.2 // indirect
+	golang.org/x/sys v0.0.0-20211117180635-dee7805ff2e1 // indirect
 )
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	// batchWriteSize is the most items BatchWriteItem accepts in one request.
+	batchWriteSize = 25
+	// maxBatchRetries is how many times unprocessed items are retried before
+	// they are counted as failed.
+	maxBatchRetries = 8
+)
+
+// sleep is replaced in tests so that retries don't slow them down.
+var sleep = time.Sleep
+
+// backoff returns how long to wait before the given retry, doubling from 50ms
+// up to a maximum of 5s.
+func backoff(attempt int) time.Duration {
+	wait := 50 * time.Millisecond << uint(attempt-1)
+	if wait > 5*time.Second || wait <= 0 {
+		return 5 * time.Second
+	}
+	return wait
+}
+
+// itemReader reads items from a file being imported.
+type itemReader interface {
+	// Read returns the next item, or io.EOF when there are no more. An
+	// invalidRowError means the row was skipped and reading can continue.
+	Read() (map[string]*dynamodb.AttributeValue, error)
+	// Row returns the row of the item that was read last.
+	Row() int
+}
+
+type invalidRowError struct {
+	row int
+	err error
+}
+
+func (e *invalidRowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.row, e.err)
+}
+
+func newItemReader(r io.Reader, format string) (itemReader, error) {
+	switch format {
+	case "jsonl":
+		return newJSONLinesReader(r, jsonToItem), nil
+	case "ddb-json":
+		return newJSONLinesReader(r, dynamoJSONToItem), nil
+	case "csv":
+		return newCSVReader(r)
+	}
+	return nil, fmt.Errorf("Unknown file format %s, expected jsonl, csv or ddb-json", format)
+}
+
+// fileFormat returns the format given with -format, or guesses it from the
+// file extension, ignoring any .gz suffix.
+func fileFormat(format, file string) string {
+	if format != "" {
+		return format
+	}
+	file = strings.TrimSuffix(strings.ToLower(file), ".gz")
+	if strings.HasSuffix(file, ".csv") {
+		return "csv"
+	}
+	return "jsonl"
+}
+
+// jsonLinesReader reads one JSON object per line, skipping blank lines.
+type jsonLinesReader struct {
+	scanner *bufio.Scanner
+	row     int
+	convert func(map[string]interface{}) (map[string]*dynamodb.AttributeValue, error)
+}
+
+func newJSONLinesReader(r io.Reader, convert func(map[string]interface{}) (map[string]*dynamodb.AttributeValue, error)) *jsonLinesReader {
+	scanner := bufio.NewScanner(r)
+	// Items can be up to 400KB, which is larger again once encoded as JSON.
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return &jsonLinesReader{
+		scanner: scanner,
+		convert: convert,
+	}
+}
+
+func (j *jsonLinesReader) Read() (map[string]*dynamodb.AttributeValue, error) {
+	for j.scanner.Scan() {
+		j.row++
+		line := strings.TrimSpace(j.scanner.Text())
+		if line == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			return nil, &invalidRowError{j.row, err}
+		}
+		item, err := j.convert(object)
+		if err != nil {
+			return nil, &invalidRowError{j.row, err}
+		}
+		return item, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (j *jsonLinesReader) Row() int {
+	return j.row
+}
+
+func jsonToItem(object map[string]interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	return jsonToAttribute(object).M, nil
+}
+
+// dynamoJSONToItem converts an item in the DynamoDB JSON wire format, as
+// written by -output ddb-json. Items wrapped in {"Item": ...}, as written by
+// the DynamoDB export to S3, are also accepted.
+func dynamoJSONToItem(object map[string]interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	if wrapped, ok := object["Item"].(map[string]interface{}); ok && len(object) == 1 {
+		object = wrapped
+	}
+	item := map[string]*dynamodb.AttributeValue{}
+	for k, v := range object {
+		av, err := dynamoJSONToAttribute(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err)
+		}
+		item[k] = av
+	}
+	return item, nil
+}
+
+func dynamoJSONToAttribute(v interface{}) (*dynamodb.AttributeValue, error) {
+	typed, ok := v.(map[string]interface{})
+	if !ok || len(typed) != 1 {
+		return nil, errors.New("Expected an object with a single type, such as {\"S\": \"foo\"}")
+	}
+	for t, v := range typed {
+		switch t {
+		case "S", "N":
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("Expected %s to be a string", t)
+			}
+			if t == "S" {
+				return &dynamodb.AttributeValue{S: aws.String(s)}, nil
+			}
+			return &dynamodb.AttributeValue{N: aws.String(s)}, nil
+		case "B":
+			s, ok := v.(string)
+			if !ok {
+				return nil, errors.New("Expected B to be a base64 string")
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, err
+			}
+			return &dynamodb.AttributeValue{B: b}, nil
+		case "BOOL", "NULL":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("Expected %s to be true or false", t)
+			}
+			if t == "BOOL" {
+				return &dynamodb.AttributeValue{BOOL: aws.Bool(b)}, nil
+			}
+			return &dynamodb.AttributeValue{NULL: aws.Bool(b)}, nil
+		case "SS", "NS", "BS":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Expected %s to be a list of strings", t)
+			}
+			av := &dynamodb.AttributeValue{}
+			for _, element := range list {
+				s, ok := element.(string)
+				if !ok {
+					return nil, fmt.Errorf("Expected %s to be a list of strings", t)
+				}
+				switch t {
+				case "SS":
+					av.SS = append(av.SS, aws.String(s))
+				case "NS":
+					av.NS = append(av.NS, aws.String(s))
+				case "BS":
+					b, err := base64.StdEncoding.DecodeString(s)
+					if err != nil {
+						return nil, err
+					}
+					av.BS = append(av.BS, b)
+				}
+			}
+			return av, nil
+		case "L":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, errors.New("Expected L to be a list")
+			}
+			l := []*dynamodb.AttributeValue{}
+			for _, element := range list {
+				av, err := dynamoJSONToAttribute(element)
+				if err != nil {
+					return nil, err
+				}
+				l = append(l, av)
+			}
+			return &dynamodb.AttributeValue{L: l}, nil
+		case "M":
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("Expected M to be an object")
+			}
+			item, err := dynamoJSONToItem(m)
+			if err != nil {
+				return nil, err
+			}
+			return &dynamodb.AttributeValue{M: item}, nil
+		}
+		return nil, fmt.Errorf("Unknown type %s", t)
+	}
+	return nil, nil
+}
+
+// csvReader reads a CSV file with a header row. Each column in the header can
+// have a type hint, such as count:N. Columns without a hint are strings.
+// Empty cells are left out of the item.
+//
+// Supported hints are S, N, BOOL, B (base64), SS, NS and BS (JSON arrays of
+// strings, numbers or base64 strings), and L and M (JSON).
+type csvReader struct {
+	reader  *csv.Reader
+	columns []string
+	types   []string
+	row     int
+}
+
+var csvTypes = map[string]bool{
+	"S": true, "N": true, "BOOL": true, "B": true,
+	"SS": true, "NS": true, "BS": true, "L": true, "M": true, "NULL": true,
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CSV header: %s", err)
+	}
+	c := &csvReader{reader: reader, row: 1}
+	for _, column := range header {
+		name, hint := column, "S"
+		if i := strings.LastIndex(column, ":"); i >= 0 {
+			name, hint = column[:i], strings.ToUpper(column[i+1:])
+		}
+		if !csvTypes[hint] {
+			return nil, fmt.Errorf("Unknown type %s for CSV column %s", hint, name)
+		}
+		c.columns = append(c.columns, name)
+		c.types = append(c.types, hint)
+	}
+	return c, nil
+}
+
+func (c *csvReader) Row() int {
+	return c.row
+}
+
+func (c *csvReader) Read() (map[string]*dynamodb.AttributeValue, error) {
+	record, err := c.reader.Read()
+	c.row++
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		if parseErr, ok := err.(*csv.ParseError); ok && parseErr.Err == csv.ErrFieldCount {
+			return nil, &invalidRowError{c.row, err}
+		}
+		return nil, err
+	}
+	item := map[string]*dynamodb.AttributeValue{}
+	for i, cell := range record {
+		if cell == "" {
+			continue
+		}
+		av, err := csvCellToAttribute(cell, c.types[i])
+		if err != nil {
+			return nil, &invalidRowError{c.row, fmt.Errorf("%s: %s", c.columns[i], err)}
+		}
+		item[c.columns[i]] = av
+	}
+	return item, nil
+}
+
+func csvCellToAttribute(cell, hint string) (*dynamodb.AttributeValue, error) {
+	// null can only be told apart from a string in other columns.
+	if cell == "null" && hint != "S" {
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}, nil
+	}
+	switch hint {
+	case "NULL":
+		return nil, fmt.Errorf("Expected null, got %s", cell)
+	case "S":
+		return &dynamodb.AttributeValue{S: aws.String(cell)}, nil
+	case "N":
+		if !decimalNumber.MatchString(cell) {
+			return nil, fmt.Errorf("Invalid number %s", cell)
+		}
+		return &dynamodb.AttributeValue{N: aws.String(cell)}, nil
+	case "BOOL":
+		switch strings.ToLower(cell) {
+		case "true":
+			return &dynamodb.AttributeValue{BOOL: aws.Bool(true)}, nil
+		case "false":
+			return &dynamodb.AttributeValue{BOOL: aws.Bool(false)}, nil
+		}
+		return nil, fmt.Errorf("Invalid bool %s", cell)
+	case "B":
+		b, err := base64.StdEncoding.DecodeString(cell)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{B: b}, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(cell))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if hint == "L" || hint == "M" {
+		av := jsonToAttribute(v)
+		if (hint == "L" && av.L == nil) || (hint == "M" && av.M == nil) {
+			return nil, fmt.Errorf("Expected a JSON %s", map[string]string{"L": "array", "M": "object"}[hint])
+		}
+		return av, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("Expected a JSON array")
+	}
+	var strs []interface{}
+	for _, element := range list {
+		if n, ok := element.(json.Number); ok {
+			element = n.String()
+		}
+		strs = append(strs, element)
+	}
+	return dynamoJSONToAttribute(map[string]interface{}{hint: strs})
+}
+
+// importItems writes every item in a file to the table using BatchWriteItem.
+// Rows that can't be converted or don't have the table's key, and items
+// DynamoDB still hasn't processed after retrying, are reported and counted as
+// failed. A row with the same key as an earlier row in the same batch
+// replaces it, as BatchWriteItem refuses to write a key twice. If the file is
+// a directory written by export, every file listed in its manifest is
+// imported.
+func importItems(args ddbArgs) (string, error) {
+	info, err := os.Stat(args.File)
+	if err != nil {
+		return "", err
+	}
+	i := &importer{args: args, progress: args.Progress}
+	if i.progress == nil {
+		i.progress = ioutil.Discard
+	}
+	if !info.IsDir() {
+		err = i.importFile(args.File, fileFormat(args.FileFormat, args.File))
+	} else {
+		err = i.importExport(args.File)
+	}
+	if err == nil && len(i.batch) > 0 {
+		err = i.flush()
+	}
+	// The counts are returned with any error, to show how far the import got.
+	result := fmt.Sprintf("%d items written, %d failed", i.written, i.failed)
+	if i.replaced > 0 {
+		result += fmt.Sprintf(", %d replaced by later rows with the same key", i.replaced)
+	}
+	return result, err
+}
+
+type importer struct {
+	args     ddbArgs
+	progress io.Writer
+	written  int
+	failed   int
+	replaced int
+	batch    []*dynamodb.WriteRequest
+	// keys maps the key of each item in the batch to its request.
+	keys map[string]int
+}
+
+func (i *importer) importExport(dir string) error {
+	m, err := ioutil.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return err
+	}
+	manifest := &exportManifest{}
+	if err := json.Unmarshal(m, manifest); err != nil {
+		return fmt.Errorf("Error reading %s: %s", manifestName, err)
+	}
+	for _, file := range manifest.Files {
+		if err := i.importFile(filepath.Join(dir, file.Name), manifest.Format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importFile imports a single file, which may be gzip compressed.
+func (i *importer) importFile(path, format string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	reader, err := newItemReader(r, format)
+	if err != nil {
+		return err
+	}
+
+	for {
+		item, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if rowErr, ok := err.(*invalidRowError); ok {
+			fmt.Fprintf(i.progress, "Skipping %s\n", rowErr)
+			i.failed++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		request := &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: item},
+		}
+		if i.args.Schemas != nil {
+			key, err := i.args.Schemas.checkItem(i.args.Table, item)
+			if _, ok := err.(*validationError); ok {
+				fmt.Fprintf(i.progress, "Skipping %s\n", &invalidRowError{reader.Row(), err})
+				i.failed++
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if n, ok := i.keys[key]; ok {
+				fmt.Fprintf(i.progress, "Row %d replaces an earlier row with the same key\n", reader.Row())
+				i.batch[n] = request
+				i.replaced++
+				continue
+			}
+			if i.keys == nil {
+				i.keys = map[string]int{}
+			}
+			i.keys[key] = len(i.batch)
+		}
+		i.batch = append(i.batch, request)
+		if len(i.batch) == batchWriteSize {
+			if err := i.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i *importer) flush() error {
+	written, err := batchWrite(i.args, i.batch)
+	i.written += written
+	i.failed += len(i.batch) - written
+	i.batch = nil
+	i.keys = nil
+	return err
+}
+
+// batchWrite writes a batch of requests, retrying unprocessed items with
+// exponential backoff. It returns how many of the requests were written.
+func batchWrite(args ddbArgs, requests []*dynamodb.WriteRequest) (int, error) {
+	total := len(requests)
+	for attempt := 0; len(requests) > 0; attempt++ {
+		if attempt > 0 {
+			if attempt > maxBatchRetries {
+				break
+			}
+			sleep(backoff(attempt))
+		}
+		resp, err := args.Client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				args.Table: requests,
+			},
+		})
+		if err != nil {
+			return total - len(requests), err
+		}
+		requests = resp.UnprocessedItems[args.Table]
+	}
+	return total - len(requests), nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// BatchWriteItem leaves items with a "retry" attribute unprocessed the first
+// time they are written, and items with a "fail" attribute unprocessed every
+// time. A batch with an "error" attribute fails.
+func (d *mockDynamo) BatchWriteItem(input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	d.batchWrites = append(d.batchWrites, input)
+	for _, requests := range input.RequestItems {
+		for _, request := range requests {
+			if request.PutRequest.Item["error"] != nil {
+				return nil, errors.New("Batch failed")
+			}
+		}
+	}
+	if d.retried == nil {
+		d.retried = map[string]bool{}
+	}
+	output := &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]*dynamodb.WriteRequest{},
+	}
+	for table, requests := range input.RequestItems {
+		for _, request := range requests {
+			item := request.PutRequest.Item
+			retry := item["retry"] != nil && !d.retried[aws.StringValue(item["id"].S)]
+			if item["fail"] != nil || retry {
+				d.retried[aws.StringValue(item["id"].S)] = true
+				output.UnprocessedItems[table] = append(output.UnprocessedItems[table], request)
+			}
+		}
+	}
+	return output, nil
+}
+
+func importSetup(t *testing.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "ddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sleep = func(time.Duration) {}
+	return path
+}
+
+func importFile(t *testing.T, client *mockDynamo, path, format string) (string, string) {
+	defer os.RemoveAll(filepath.Dir(path))
+	progress := &bytes.Buffer{}
+	result, err := run(ddbArgs{
+		Client:     client,
+		Command:    "import",
+		Table:      "testing",
+		File:       path,
+		FileFormat: format,
+		Progress:   progress,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	return result, progress.String()
+}
+
+func TestImportJSONLines(t *testing.T) {
+	path := importSetup(t, "items.jsonl", `{"id": "a", "count": 12345678901234567890, "tags": ["x", 1]}
+
+{"id": "b", "active": false, "meta": {"n": null}}
+`)
+	client := &mockDynamo{}
+	result, _ := importFile(t, client, path, "")
+	if result != "2 items written, 0 failed" {
+		t.Errorf("Expected 2 items written, got %s", result)
+	}
+	if len(client.batchWrites) != 1 {
+		t.Fatalf("Expected one BatchWriteItem request, got %d", len(client.batchWrites))
+	}
+	requests := client.batchWrites[0].RequestItems["testing"]
+	if len(requests) != 2 {
+		t.Fatalf("Expected two items, got %d", len(requests))
+	}
+	first := requests[0].PutRequest.Item
+	if *first["count"].N != "12345678901234567890" {
+		t.Errorf("Expected count to keep its precision, got %s", *first["count"].N)
+	}
+	if *first["tags"].L[1].N != "1" {
+		t.Errorf("Expected a number in the list, got %s", first["tags"].L[1])
+	}
+	second := requests[1].PutRequest.Item
+	if *second["active"].BOOL != false {
+		t.Errorf("Expected active to be false, got %s", second["active"])
+	}
+	if *second["meta"].M["n"].NULL != true {
+		t.Errorf("Expected meta.n to be NULL, got %s", second["meta"])
+	}
+}
+
+func TestImportBatches(t *testing.T) {
+	var lines []string
+	for i := 0; i < 60; i++ {
+		lines = append(lines, `{"id": "x"}`)
+	}
+	path := importSetup(t, "items.jsonl", strings.Join(lines, "\n"))
+	client := &mockDynamo{}
+	result, _ := importFile(t, client, path, "")
+	if result != "60 items written, 0 failed" {
+		t.Errorf("Expected 60 items written, got %s", result)
+	}
+	sizes := []int{25, 25, 10}
+	if len(client.batchWrites) != len(sizes) {
+		t.Fatalf("Expected %d BatchWriteItem requests, got %d", len(sizes), len(client.batchWrites))
+	}
+	for i, size := range sizes {
+		if n := len(client.batchWrites[i].RequestItems["testing"]); n != size {
+			t.Errorf("Expected batch %d to have %d items, got %d", i, size, n)
+		}
+	}
+}
+
+func TestImportChecksKeys(t *testing.T) {
+	path := importSetup(t, "items.jsonl", `{"author": "a", "published": 1949}
+{"author": "a", "published": "1949", "title": "1984"}
+{"published": 1}
+{"author": true, "published": 2}
+{"author": "b", "published": 2}
+{"author": "b", "published": 2.0}
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	client := &mockDynamo{}
+	progress := &bytes.Buffer{}
+	result, err := run(ddbArgs{
+		Client:   client,
+		Command:  "import",
+		Table:    "authors",
+		File:     path,
+		Progress: progress,
+		Schemas:  newSchemaCache(client, ""),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if result != "2 items written, 2 failed, 2 replaced by later rows with the same key" {
+		t.Errorf("Expected invalid rows to fail and a duplicate to be replaced, got %s", result)
+	}
+	if !strings.Contains(progress.String(), "Skipping row 3: Missing the partition key author (S)") ||
+		!strings.Contains(progress.String(), "Skipping row 4: author must be a string (S)") {
+		t.Errorf("Expected the invalid rows to be reported, got %s", progress)
+	}
+	if len(client.batchWrites) != 1 {
+		t.Fatalf("Expected one BatchWriteItem request, got %d", len(client.batchWrites))
+	}
+	requests := client.batchWrites[0].RequestItems["authors"]
+	if len(requests) != 2 {
+		t.Fatalf("Expected two items, got %d", len(requests))
+	}
+	first := requests[0].PutRequest.Item
+	if first["title"] == nil || first["published"].N == nil || *first["published"].N != "1949" {
+		t.Errorf("Expected the later row with the key converted to a number, got %s", first)
+	}
+	if client.describes != 1 {
+		t.Errorf("Expected the table to be described once, got %d", client.describes)
+	}
+}
+
+func TestImportReportsCountsOnError(t *testing.T) {
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, `{"id": "x"}`)
+	}
+	lines = append(lines, `{"id": "y", "error": true}`)
+	path := importSetup(t, "items.jsonl", strings.Join(lines, "\n"))
+	defer os.RemoveAll(filepath.Dir(path))
+	result, err := run(ddbArgs{
+		Client:  &mockDynamo{},
+		Command: "import",
+		Table:   "testing",
+		File:    path,
+	})
+	if err == nil || err.Error() != "Batch failed" {
+		t.Errorf("Expected the batch to fail, got %v", err)
+	}
+	if result != "25 items written, 6 failed" {
+		t.Errorf("Expected the counts so far, got %s", result)
+	}
+}
+
+func TestImportRetriesUnprocessedItems(t *testing.T) {
+	path := importSetup(t, "items.jsonl", `{"id": "a"}
+{"id": "b", "retry": true}
+{"id": "c", "fail": true}
+`)
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	client := &mockDynamo{}
+	result, _ := importFile(t, client, path, "")
+	if result != "2 items written, 1 failed" {
+		t.Errorf("Expected 2 items written and 1 failed, got %s", result)
+	}
+	if len(client.batchWrites) != maxBatchRetries+1 {
+		t.Errorf("Expected %d BatchWriteItem requests, got %d", maxBatchRetries+1, len(client.batchWrites))
+	}
+	if n := len(client.batchWrites[1].RequestItems["testing"]); n != 2 {
+		t.Errorf("Expected the retry to only contain the unprocessed items, got %d", n)
+	}
+	if len(waits) != maxBatchRetries || waits[0] != backoff(1) || waits[1] != backoff(2) {
+		t.Errorf("Expected a backoff before each retry, got %v", waits)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, e := range expected {
+		if b := backoff(i + 1); b != e {
+			t.Errorf("Expected retry %d to wait %s, got %s", i+1, e, b)
+		}
+	}
+	if b := backoff(20); b != 5*time.Second {
+		t.Errorf("Expected backoff to be capped at 5s, got %s", b)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	path := importSetup(t, "items.csv", `id,count:N,active:bool,tags:SS,scores:NS,data:B,meta:M
+a,1.50,true,"[""x"",""y""]","[1, 2.5]",aGVsbG8=,"{""n"": 1}"
+b,,false,,,,
+c,abc,true,,,,
+d,1
+`)
+	client := &mockDynamo{}
+	result, progress := importFile(t, client, path, "")
+	if result != "2 items written, 2 failed" {
+		t.Errorf("Expected 2 items written and 2 failed, got %s", result)
+	}
+	if !strings.Contains(progress, "row 4: count: Invalid number abc") {
+		t.Errorf("Expected the invalid number to be reported, got %s", progress)
+	}
+	if !strings.Contains(progress, "row 5") {
+		t.Errorf("Expected the short row to be reported, got %s", progress)
+	}
+	requests := client.batchWrites[0].RequestItems["testing"]
+	first := requests[0].PutRequest.Item
+	if *first["id"].S != "a" || *first["count"].N != "1.50" || *first["active"].BOOL != true {
+		t.Errorf("Expected scalar columns to be converted, got %s", first)
+	}
+	if len(first["tags"].SS) != 2 || *first["scores"].NS[1] != "2.5" {
+		t.Errorf("Expected set columns to be converted, got %s", first)
+	}
+	if string(first["data"].B) != "hello" || *first["meta"].M["n"].N != "1" {
+		t.Errorf("Expected binary and map columns to be converted, got %s", first)
+	}
+	second := requests[1].PutRequest.Item
+	if _, ok := second["count"]; ok {
+		t.Errorf("Expected empty cells to be left out, got %s", second)
+	}
+}
+
+func TestImportCSVNull(t *testing.T) {
+	path := importSetup(t, "items.csv", `id,count:N,name,gone:NULL
+a,null,null,null
+`)
+	client := &mockDynamo{}
+	if result, progress := importFile(t, client, path, ""); result != "1 items written, 0 failed" {
+		t.Fatalf("Expected 1 item written, got %s: %s", result, progress)
+	}
+	item := client.batchWrites[0].RequestItems["testing"][0].PutRequest.Item
+	if item["count"].NULL == nil || item["gone"].NULL == nil {
+		t.Errorf("Expected null cells to be NULL, got %s", item)
+	}
+	if *item["name"].S != "null" {
+		t.Errorf("Expected null in a string column to be a string, got %s", item)
+	}
+}
+
+func TestImportCSVUnknownType(t *testing.T) {
+	path := importSetup(t, "items.csv", "id:X\na\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	_, err := run(ddbArgs{
+		Client:  &mockDynamo{},
+		Command: "import",
+		Table:   "testing",
+		File:    path,
+	})
+	if err == nil || err.Error() != "Unknown type X for CSV column id" {
+		t.Errorf("Expected an unknown type error, got %v", err)
+	}
+}
+
+func TestImportDynamoJSON(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer, _ := newItemWriter(output, "ddb-json")
+	writer.Write([]map[string]*dynamodb.AttributeValue{
+		{
+			"id":   {S: aws.String("a")},
+			"n":    {N: aws.String("1.0")},
+			"b":    {B: []byte("hi")},
+			"null": {NULL: aws.Bool(true)},
+			"ns":   {NS: []*string{aws.String("1"), aws.String("2")}},
+			"bs":   {BS: [][]byte{[]byte("x")}},
+			"l":    {L: []*dynamodb.AttributeValue{{BOOL: aws.Bool(false)}}},
+			"m":    {M: map[string]*dynamodb.AttributeValue{"s": {SS: []*string{aws.String("x")}}}},
+		},
+	})
+	writer.Close()
+	path := importSetup(t, "items.json", output.String()+`{"Item": {"id": {"S": "b"}}}
+{"id": {"X": "c"}}
+`)
+	client := &mockDynamo{}
+	result, progress := importFile(t, client, path, "ddb-json")
+	if result != "2 items written, 1 failed" {
+		t.Errorf("Expected 2 items written and 1 failed, got %s", result)
+	}
+	if !strings.Contains(progress, "row 3: id: Unknown type X") {
+		t.Errorf("Expected the unknown type to be reported, got %s", progress)
+	}
+	requests := client.batchWrites[0].RequestItems["testing"]
+	output.Reset()
+	writer, _ = newItemWriter(output, "ddb-json")
+	writer.Write([]map[string]*dynamodb.AttributeValue{requests[0].PutRequest.Item, requests[1].PutRequest.Item})
+	writer.Close()
+	expected := `{"b":{"B":"aGk="},"bs":{"BS":["eA=="]},"id":{"S":"a"},"l":{"L":[{"BOOL":false}]},"m":{"M":{"s":{"SS":["x"]}}},"n":{"N":"1.0"},"ns":{"NS":["1","2"]},"null":{"NULL":true}}
+{"id":{"S":"b"}}
+`
+	if output.String() != expected {
+		t.Errorf("Expected items to round trip as %s, got %s", expected, output)
+	}
+}
@@ -1,18 +1,25 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"strconv"
+	"os"
+	"regexp"
+	"strings"
+	"text/scanner"
 
 	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
@@ -26,21 +33,105 @@ type attribute struct {
 }
 
 type value struct {
-	Number *float64   ` @(Float|Int)`
-	Bool   *bool      `| (@"true" | "false")`
+	Number *number ` @( [ "-" ] ( Float | Int ) )`
+	literal
 	Set    []*value   `| "(" { @@ [ "," ] } ")"`
 	List   []*value   `| "[" { @@ [ "," ] } "]"`
 	Map    *dynamoMap `| @RawString`
-	Binary *binary    `| "{" @String "}"`
+	Binary *binary    `| "{" ( @String | @"-" ) "}"`
 	String *string    `| @(Ident|String)`
 }
 
+// literal is the values that start with a keyword, which are written the
+// same way in every statement. It's embedded in the alternatives of value and
+// updateOperand, where it's tried before words are read as strings or paths.
+type literal struct {
+	Bool     *boolean   `| @@`
+	Null     *null      `| @@`
+	Cast     *cast      `| @@`
+	Function *function  `| @@`
+	Object   *object    `| @@`
+	Base64   *base64Bin `| "b64":Ident @String`
+	Hex      *hexBinary `| "hex":Ident @String`
+}
+
+// number is kept as the decimal string that was written, as DynamoDB numbers
+// have up to 38 digits of precision and would be rounded by a float64.
+type number string
+
+var decimalNumber = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+func (n *number) Capture(v []string) error {
+	s := strings.Join(v, "")
+	if !decimalNumber.MatchString(s) {
+		return fmt.Errorf("Invalid number %s, numbers must be written in decimal", s)
+	}
+	*n = number(s)
+	return nil
+}
+
+// boolean and null are values rather than keywords, so unlike keywords they
+// must be written in lower case, and TRUE or Null is a string.
+type boolean bool
+
+func (b *boolean) Parse(lex lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Value != "true" && token.Value != "false" {
+		return participle.NextMatch
+	}
+	*b = boolean(token.Value == "true")
+	_, err = lex.Next()
+	return err
+}
+
+type null struct{}
+
+func (n *null) Parse(lex lexer.PeekingLexer) error {
+	token, err := lex.Peek(0)
+	if err != nil {
+		return err
+	}
+	if token.Type != scanner.Ident || token.Value != "null" {
+		return participle.NextMatch
+	}
+	_, err = lex.Next()
+	return err
+}
+
+// cast gives a value an explicit type, instead of the one it would be given
+// from how it was written, such as S(123) for a string of digits or NS[1,2]
+// for a number set.
+type cast struct {
+	Type castType `@( "S":Ident | "N":Ident | "B":Ident | "BOOL":Ident | "SS":Ident | "NS":Ident | "BS":Ident | "L":Ident )`
+	Set  []*value `( "(" { @@ [ "," ] } ")"`
+	List []*value `| "[" { @@ [ "," ] } "]" )`
+}
+
+type castType string
+
+func (c *castType) Capture(v []string) error {
+	*c = castType(strings.ToUpper(strings.Join(v, "")))
+	return nil
+}
+
+// binary is read from a file, {"players.gz"}, or from stdin, {-}.
 type binary []byte
 
 func (b *binary) Capture(v []string) error {
 	if len(v) != 1 {
 		return fmt.Errorf("Expected one file name, got %d", len(v))
 	}
+	if v[0] == "-" {
+		raw, err := stdin.bytes()
+		if err != nil {
+			return fmt.Errorf("Error reading stdin: %s", err)
+		}
+		*b = raw
+		return nil
+	}
 	raw, err := ioutil.ReadFile(v[0])
 	if err != nil {
 		return fmt.Errorf("Error reading file: %s", err)
@@ -49,6 +140,68 @@ func (b *binary) Capture(v []string) error {
 	return nil
 }
 
+// base64Bin is binary written inline as base64, b64"SGVsbG8=".
+type base64Bin []byte
+
+func (b *base64Bin) Capture(v []string) error {
+	s := strings.Join(v, "")
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("Invalid base64 %q: %s", s, err)
+	}
+	*b = raw
+	return nil
+}
+
+// hexBinary is binary written inline as hex, hex"48656c6c6f".
+type hexBinary []byte
+
+func (b *hexBinary) Capture(v []string) error {
+	s := strings.Join(v, "")
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return fmt.Errorf("Invalid hex %q: %s", s, err)
+	}
+	*b = raw
+	return nil
+}
+
+// stdin is read for {-} the first time it is used, and the same bytes are
+// used again if it is repeated.
+var stdin = &stdinReader{r: os.Stdin}
+
+type stdinReader struct {
+	r    io.Reader
+	read bool
+	data []byte
+	err  error
+}
+
+func (s *stdinReader) bytes() ([]byte, error) {
+	if !s.read {
+		s.data, s.err = ioutil.ReadAll(s.r)
+		s.read = true
+	}
+	return s.data, s.err
+}
+
+// reserveStdin stops {-} from reading stdin when it is already being read as
+// something else, such as a transact script.
+func reserveStdin(by string) {
+	stdin = &stdinReader{read: true, err: fmt.Errorf("stdin is already being read as %s", by)}
+}
+
+// object is a map written as map{key: value, ...}. Any value can be nested
+// in it, unlike a map written as JSON.
+type object struct {
+	Entries []*entry `"map":Ident "{" { @@ [ "," ] } "}"`
+}
+
+type entry struct {
+	Key   string `@(Ident|String) ":"`
+	Value *value `@@`
+}
+
 type dynamoMap map[string]*dynamodb.AttributeValue
 
 func (d *dynamoMap) Capture(v []string) error {
@@ -58,247 +211,681 @@ func (d *dynamoMap) Capture(v []string) error {
 	if len(v) > 1 {
 		return errors.New("Multiple JSON objects detected, wanted one")
 	}
+	decoder := json.NewDecoder(strings.NewReader(v[0]))
+	decoder.UseNumber()
 	var jsonBlob interface{}
-	err := json.Unmarshal([]byte(v[0]), &jsonBlob)
+	err := decoder.Decode(&jsonBlob)
 	if err != nil {
 		return err
 	}
-	av, err := dynamodbattribute.MarshalMap(jsonBlob)
-	*d = dynamoMap(av)
+	av := jsonToAttribute(jsonBlob)
+	if av.M == nil {
+		return errors.New("Expected a JSON object")
+	}
+	*d = dynamoMap(av.M)
 	return nil
 }
 
-func valueToAttribute(v *value) *dynamodb.AttributeValue {
+// jsonToAttribute converts a value decoded from JSON with UseNumber set, so
+// that numbers keep their original precision.
+func jsonToAttribute(v interface{}) *dynamodb.AttributeValue {
+	switch v := v.(type) {
+	case bool:
+		return &dynamodb.AttributeValue{
+			BOOL: aws.Bool(v),
+		}
+	case json.Number:
+		return &dynamodb.AttributeValue{
+			N: aws.String(v.String()),
+		}
+	case string:
+		return &dynamodb.AttributeValue{
+			S: aws.String(v),
+		}
+	case []interface{}:
+		list := []*dynamodb.AttributeValue{}
+		for _, element := range v {
+			list = append(list, jsonToAttribute(element))
+		}
+		return &dynamodb.AttributeValue{
+			L: list,
+		}
+	case map[string]interface{}:
+		m := map[string]*dynamodb.AttributeValue{}
+		for key, element := range v {
+			m[key] = jsonToAttribute(element)
+		}
+		return &dynamodb.AttributeValue{
+			M: m,
+		}
+	}
+	return &dynamodb.AttributeValue{
+		NULL: aws.Bool(true),
+	}
+}
+
+func valueToAttribute(v *value) (*dynamodb.AttributeValue, error) {
 	switch {
 	case v.String != nil:
 		return &dynamodb.AttributeValue{
 			S: v.String,
-		}
+		}, nil
 	case v.Bool != nil:
 		return &dynamodb.AttributeValue{
-			BOOL: v.Bool,
-		}
+			BOOL: aws.Bool(bool(*v.Bool)),
+		}, nil
+	case v.Null != nil:
+		return &dynamodb.AttributeValue{
+			NULL: aws.Bool(true),
+		}, nil
 	case v.Set != nil:
-		if ok, stringSet := allString(v.Set); ok {
-			return &dynamodb.AttributeValue{
-				SS: stringSet,
-			}
-		} else if ok, numberSet := allNumber(v.Set); ok {
-			return &dynamodb.AttributeValue{
-				NS: numberSet,
-			}
-		} else if ok, binarySet := allBinary(v.Set); ok {
-			return &dynamodb.AttributeValue{
-				BS: binarySet,
-			}
-		} else {
-			panic("Invalid values found in Set. Must be all strings, all numbers or all binary")
-		}
+		return convertSet(v.Set)
 	case v.Number != nil:
 		return &dynamodb.AttributeValue{
-			N: convertFloatToString(v.Number),
-		}
+			N: aws.String(string(*v.Number)),
+		}, nil
+	case v.Cast != nil:
+		return castToAttribute(v.Cast)
+	case v.Function != nil:
+		return v.Function.call()
 	case v.List != nil:
-		return &dynamodb.AttributeValue{
-			L: convertListToAttributeValue(v.List),
+		list, err := convertListToAttributeValue(v.List)
+		if err != nil {
+			return nil, err
 		}
+		return &dynamodb.AttributeValue{
+			L: list,
+		}, nil
 	case v.Map != nil:
 		return &dynamodb.AttributeValue{
 			M: map[string]*dynamodb.AttributeValue(*v.Map),
+		}, nil
+	case v.Object != nil:
+		m := map[string]*dynamodb.AttributeValue{}
+		for _, e := range v.Object.Entries {
+			if _, ok := m[e.Key]; ok {
+				return nil, validationErrorf("Duplicate key %s in map", e.Key)
+			}
+			av, err := valueToAttribute(e.Value)
+			if err != nil {
+				return nil, validationErrorf("%s: %s", e.Key, err)
+			}
+			m[e.Key] = av
 		}
-	case v.Binary != nil:
 		return &dynamodb.AttributeValue{
-			B: []byte(*v.Binary),
-		}
+			M: m,
+		}, nil
+	case v.binaryValue() != nil:
+		return &dynamodb.AttributeValue{
+			B: v.binaryValue(),
+		}, nil
 	}
 
-	panic("Unable to convert value into AttributeValue")
+	return nil, validationErrorf("Unable to convert value into AttributeValue")
 }
 
-func convertFloatToString(num *float64) *string {
-	return aws.String(strconv.FormatFloat(*num, 'E', -1, 64))
+// castToAttribute converts the values of a cast to its type. Scalar types
+// take one value in parentheses, while sets and lists take any number of
+// values in parentheses or brackets.
+func castToAttribute(c *cast) (*dynamodb.AttributeValue, error) {
+	t := string(c.Type)
+	values := c.Set
+	if c.List != nil {
+		values = c.List
+	}
+	switch t {
+	case "L":
+		list, err := convertListToAttributeValue(values)
+		if err != nil {
+			return nil, err
+		}
+		return &dynamodb.AttributeValue{
+			L: list,
+		}, nil
+	case "SS", "NS", "BS":
+		if len(values) == 0 {
+			return nil, validationErrorf("%s needs at least one value, DynamoDB doesn't store empty sets", t)
+		}
+		set := &dynamodb.AttributeValue{}
+		for _, v := range values {
+			av, err := castScalar(t[:1], v)
+			if err != nil {
+				return nil, err
+			}
+			switch t {
+			case "SS":
+				set.SS = append(set.SS, av.S)
+			case "NS":
+				set.NS = append(set.NS, av.N)
+			case "BS":
+				set.BS = append(set.BS, av.B)
+			}
+		}
+		return set, nil
+	}
+	if c.List != nil || len(c.Set) != 1 {
+		return nil, validationErrorf("%s takes one value in parentheses, such as %s(...)", t, t)
+	}
+	return castScalar(t, c.Set[0])
 }
 
-func convertListToAttributeValue(list []*value) []*dynamodb.AttributeValue {
-	listValue := []*dynamodb.AttributeValue{}
-	for _, a := range list {
-		listValue = append(listValue, valueToAttribute(a))
+// castScalar converts a value to the scalar type t, if it can be represented
+// as that type without losing anything.
+func castScalar(t string, v *value) (*dynamodb.AttributeValue, error) {
+	av, err := valueToAttribute(v)
+	if err != nil {
+		return nil, err
 	}
-	return listValue
+	from := attributeType(av)
+	switch {
+	case from == t:
+		return av, nil
+	case t == "S" && av.N != nil:
+		return &dynamodb.AttributeValue{S: av.N}, nil
+	case t == "S" && av.BOOL != nil:
+		return &dynamodb.AttributeValue{S: aws.String(fmt.Sprint(*av.BOOL))}, nil
+	case t == "N" && av.S != nil:
+		if !decimalNumber.MatchString(*av.S) {
+			return nil, validationErrorf("Can't cast %q to N, numbers must be written in decimal", *av.S)
+		}
+		return &dynamodb.AttributeValue{N: av.S}, nil
+	case t == "B" && av.S != nil:
+		return &dynamodb.AttributeValue{B: []byte(*av.S)}, nil
+	case t == "BOOL" && av.S != nil:
+		switch strings.ToLower(*av.S) {
+		case "true", "false":
+			return &dynamodb.AttributeValue{BOOL: aws.Bool(strings.EqualFold(*av.S, "true"))}, nil
+		}
+		return nil, validationErrorf("Can't cast %q to BOOL, expected true or false", *av.S)
+	}
+	return nil, validationErrorf("Can't cast %s to %s", from, t)
 }
 
-func allString(set []*value) (bool, []*string) {
-	stringSet := []*string{}
-	for _, v := range set {
-		if v.String == nil {
-			return false, stringSet
+func convertListToAttributeValue(list []*value) ([]*dynamodb.AttributeValue, error) {
+	listValue := []*dynamodb.AttributeValue{}
+	for _, a := range list {
+		av, err := valueToAttribute(a)
+		if err != nil {
+			return nil, err
 		}
-		stringSet = append(stringSet, v.String)
+		listValue = append(listValue, av)
 	}
-	return true, stringSet
+	return listValue, nil
 }
 
-func allNumber(set []*value) (bool, []*string) {
-	numberSet := []*string{}
-	for _, v := range set {
-		if v.Number == nil {
-			return false, numberSet
-		}
-		numberSet = append(numberSet, convertFloatToString(v.Number))
+// binaryValue returns the bytes of a binary value, whether it was read from a
+// file or stdin or written inline, or nil if the value isn't binary.
+func (v *value) binaryValue() []byte {
+	switch {
+	case v.Binary != nil:
+		return []byte(*v.Binary)
+	case v.Base64 != nil:
+		return []byte(*v.Base64)
+	case v.Hex != nil:
+		return []byte(*v.Hex)
 	}
-	return true, numberSet
+	return nil
 }
 
-func allBinary(set []*value) (bool, [][]byte) {
-	binarySet := [][]byte{}
-	for _, v := range set {
-		if v.Binary == nil {
-			return false, binarySet
+// convertSet converts the values of a set, which must all be strings, all
+// numbers or all binary once they are converted, so that casts and functions
+// can be used in sets too.
+func convertSet(set []*value) (*dynamodb.AttributeValue, error) {
+	av := &dynamodb.AttributeValue{}
+	setType := "SS"
+	for i, v := range set {
+		element, err := valueToAttribute(v)
+		if err != nil {
+			return nil, err
 		}
-		binarySet = append(binarySet, []byte(*v.Binary))
+		t := attributeType(element) + "S"
+		if i > 0 && t != setType {
+			t = ""
+		}
+		switch t {
+		case "SS":
+			av.SS = append(av.SS, element.S)
+		case "NS":
+			av.NS = append(av.NS, element.N)
+		case "BS":
+			av.BS = append(av.BS, element.B)
+		default:
+			return nil, validationErrorf("Invalid values found in Set. Must be all strings, all numbers or all binary")
+		}
+		setType = t
 	}
-	return true, binarySet
+	if setType == "SS" && av.SS == nil {
+		av.SS = []*string{}
+	}
+	return av, nil
 }
 
 type ddbArgs struct {
-	Client    dynamodbiface.DynamoDBAPI
-	Table     string
-	Command   string
-	Arguments *keyValue
+	Client       dynamodbiface.DynamoDBAPI
+	Table        string
+	Command      string
+	Arguments    *keyValue
+	KeyCondition *keyCondition
+	Update       *updateStatement
+	Condition    *condition
+	Filter       *condition
+	Projection   *projection
+	Output       io.Writer
+	Format       string
+	Segments     int
+	Progress     io.Writer
+	ReturnValues string
+	File         string
+	FileFormat   string
+	OutDir       string
+	Gzip         bool
+	ItemsPerFile int
+	Keys         []*keyValue
+	Operations   []*transactOperation
+	Schemas      *schemaCache
+	Index        string
 }
 
 func main() {
+	if err := cli(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+}
 
+// cli parses the flags and runs the command. Errors are returned as one of
+// the types in errors.go, so that main can choose the exit code.
+func cli() error {
 	table := flag.String("table", "", "The name of the table")
-	command := flag.String("command", "get", "The command, to get or set values")
-	statement := flag.String("statement", "", "A comma seperated list of key=value pairs to get or set in dynamo. Strings must be quoted (remember to escape them from your shell).")
+	command := flag.String("command", "get", "The command, to get, set, delete, update, scan, query, batch-get, transact, import or export values")
+	var statements statementList
+	flag.Var(&statements, "statement", "A comma seperated list of key=value pairs to get or set in dynamo. Strings must be quoted (remember to escape them from your shell). Repeat it to get several keys with batch-get")
 	endpoint := flag.String("endpoint", "", "Endpoint URL for DynamoDB. Useful for testing with local DynamoDB")
-	flag.Parse()
+	conditionExpression := flag.String("condition", "", "A condition that must hold for a set, update or delete to succeed, such as 'attribute_not_exists(key)' or 'version = 3'")
+	filter := flag.String("filter", "", "A filter applied to the items read by scan or query, such as 'status in (\"active\", \"pending\") and size(tags) > 2'")
+	output := flag.String("output", "json", "The output format: json, jsonl for one JSON object per line, or ddb-json for one DynamoDB JSON object per line, which keeps every type intact. Scan and query write items as they are read")
+	project := flag.String("project", "", "A comma separated list of attributes to read with get, scan or query, such as 'a, b.c, list[0]'")
+	index := flag.String("index", "", "The name of a global or local secondary index to query or scan")
+	segments := flag.Int("segments", 1, "The number of segments to scan in parallel")
+	file := flag.String("file", "", "The file to read items from with import, keys from with batch-get, one statement per line, or the script to run with transact. Use - to read a transact script from stdin")
+	format := flag.String("format", "", "The format of the files read by import or written by export: jsonl, csv or ddb-json. Import defaults to csv for .csv files and jsonl otherwise")
+	out := flag.String("out", "", "The directory to export to")
+	gzipFiles := flag.Bool("gzip", false, "Compress exported files with gzip")
+	itemsPerFile := flag.Int("items-per-file", defaultItemsPerFile, "The number of items in each exported file. CSV files are held in memory until they are complete")
+	returnValues := flag.String("return-values", "", "The item attributes to print after a write. Use ALL_OLD with delete to print the removed item, or ALL_NEW with update to print the updated item")
+
+	// ddb tables manages tables, with flags of its own.
+	if len(os.Args) > 1 && os.Args[1] == "tables" {
+		return runTables(os.Args[2:])
+	}
 
-	usage := "Usage: ddb -table <table-name> -command <get|set|scan> -statement \"<key='value',key=123>\""
-	if *command != "get" && *command != "set" && *command != "scan" {
-		panic(usage)
+	// ddb shell starts an interactive session, which accepts the same flags.
+	shellMode := len(os.Args) > 1 && os.Args[1] == "shell"
+	if shellMode {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
 	}
-	if *table == "" {
-		panic(usage)
+
+	statement := ""
+	if len(statements) > 0 {
+		statement = statements[0]
 	}
 
-	sess := session.New()
-	if *endpoint != "" {
-		sess.Config.Endpoint = endpoint
+	usage := "Usage: ddb -table <table-name> -command <get|set|delete|update|scan|query|batch-get|transact|import|export> -statement \"<key='value',key=123>\"\n       ddb shell [-table <table-name>]\n       ddb tables list|describe|create|delete"
+	if shellMode {
+		*command = "shell"
+	}
+	switch *command {
+	case "get", "set", "delete", "update", "scan", "query", "batch-get", "transact", "import", "export", "shell":
+	default:
+		return &usageError{usage}
+	}
+	if *table == "" && *command != "transact" && *command != "shell" {
+		return &usageError{usage}
 	}
 
-	if *command == "scan" {
-		result, err := run(ddbArgs{
-			Client:  dynamodb.New(sess),
-			Table:   *table,
-			Command: *command,
-		})
-		if err != nil {
-			panic(err)
+	sess := newSession(*endpoint)
+
+	args := ddbArgs{
+		Client:       dynamodb.New(sess),
+		Table:        *table,
+		Command:      *command,
+		ReturnValues: *returnValues,
+		Output:       os.Stdout,
+		Format:       *output,
+		Segments:     *segments,
+		Progress:     os.Stderr,
+		File:         *file,
+		FileFormat:   *format,
+		OutDir:       *out,
+		Gzip:         *gzipFiles,
+		ItemsPerFile: *itemsPerFile,
+		Index:        *index,
+	}
+	args.Schemas = newSchemaCache(args.Client, schemaCacheDir(*endpoint, aws.StringValue(sess.Config.Region)))
+
+	if shellMode {
+		return runShell(args)
+	}
+
+	if *command == "import" {
+		if *file == "" {
+			return usageErrorf("Expected a -file to import")
 		}
-		fmt.Println(result)
-		return
+	} else if *command == "export" {
+		if *out == "" {
+			return usageErrorf("Expected an -out directory to export to")
+		}
+		if *format != "" && *format != "jsonl" && *format != "csv" && *format != "ddb-json" {
+			return usageErrorf("Expected -format to be jsonl, csv or ddb-json")
+		}
+		if *itemsPerFile < 1 {
+			return usageErrorf("Expected -items-per-file to be at least 1")
+		}
+	} else if *command == "transact" {
+		if *file == "" {
+			return usageErrorf("Expected a -file with the transact script")
+		}
+	} else if *command == "batch-get" {
+		if len(statements) == 0 && *file == "" {
+			return usageErrorf("Expected a -statement or a -file of keys to get")
+		}
+	} else if *command != "scan" && statement == "" {
+		return &usageError{usage}
+	}
+	if len(statements) > 1 && *command != "batch-get" {
+		return usageErrorf("Only batch-get accepts more than one -statement")
 	}
 
-	if *statement == "" {
-		panic(usage)
+	if *conditionExpression != "" {
+		if *command != "set" && *command != "update" && *command != "delete" {
+			return usageErrorf("A -condition can only be used with set, update or delete")
+		}
+		args.Condition = &condition{}
+		if err := parseStatement(*conditionExpression, args.Condition); err != nil {
+			return err
+		}
 	}
 
-	parser, err := participle.Build(&keyValue{})
-	if err != nil {
-		panic(err)
+	if *output != "json" && *output != "jsonl" && *output != "ddb-json" {
+		return usageErrorf("Expected -output to be json, jsonl or ddb-json")
+	}
+	if *segments < 1 {
+		return usageErrorf("Expected -segments to be at least 1")
+	}
+	if *segments > 1 && *command != "scan" && *command != "export" {
+		return usageErrorf("-segments can only be used with scan or export")
 	}
-	attr := &keyValue{}
-	parser.ParseString(*statement, attr)
 
-	for _, a := range attr.Attributes {
-		if a.Value == nil {
-			panic(fmt.Sprintf("Invalid statement %s", *statement))
+	if *index != "" && *command != "scan" && *command != "query" {
+		return usageErrorf("An -index can only be used with scan or query")
+	}
+
+	if *filter != "" {
+		if *command != "scan" && *command != "query" && *command != "export" {
+			return usageErrorf("A -filter can only be used with scan, query or export")
+		}
+		args.Filter = &condition{}
+		if err := parseStatement(*filter, args.Filter); err != nil {
+			return err
 		}
 	}
 
-	if *command == "get" && len(attr.Attributes) > 2 {
-		panic("Expected one or two key=value pair(s) for a get request")
+	if *project != "" {
+		if *command != "get" && *command != "batch-get" && *command != "scan" && *command != "query" && *command != "export" {
+			return usageErrorf("A -project can only be used with get, batch-get, scan, query or export")
+		}
+		args.Projection = &projection{}
+		if err := parseStatement(*project, args.Projection); err != nil {
+			return err
+		}
 	}
 
-	result, err := run(ddbArgs{
-		Client:    dynamodb.New(sess),
-		Table:     *table,
-		Command:   *command,
-		Arguments: attr,
-	})
+	switch *command {
+	case "scan", "import", "export":
+	case "batch-get":
+		keys, err := readKeys(statements, *file)
+		if err != nil {
+			return err
+		}
+		args.Keys = keys
+	case "transact":
+		script := os.Stdin
+		if *file == "-" {
+			reserveStdin("the transact script")
+		} else {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			script = f
+		}
+		operations, err := readTransactScript(script)
+		if err != nil {
+			return err
+		}
+		if len(operations) == 0 {
+			return usageErrorf("Expected at least one operation in the transact script")
+		}
+		args.Operations = operations
+	case "query":
+		args.KeyCondition = &keyCondition{}
+		if err := parseStatement(statement, args.KeyCondition); err != nil {
+			return err
+		}
+	case "update":
+		args.Update = &updateStatement{}
+		if err := parseStatement(statement, args.Update); err != nil {
+			return err
+		}
+		if *returnValues != "" && !validUpdateReturnValues[*returnValues] {
+			return usageErrorf("Expected -return-values to be NONE, ALL_OLD, UPDATED_OLD, ALL_NEW or UPDATED_NEW for an update request")
+		}
+	default:
+		attr := &keyValue{}
+		if err := parseStatement(statement, attr); err != nil {
+			return err
+		}
+
+		if (*command == "get" || *command == "delete") && len(attr.Attributes) > 2 {
+			return validationErrorf("Expected one or two key=value pair(s) for a %s request", *command)
+		}
+		if *command == "delete" && *returnValues != "" && *returnValues != "NONE" && *returnValues != "ALL_OLD" {
+			return usageErrorf("Expected -return-values to be NONE or ALL_OLD for a delete request")
+		}
+		args.Arguments = attr
+	}
+
+	result, err := run(args)
+	// Commands such as import report how far they got even if they fail.
+	if result != "" {
+		fmt.Println(result)
+	}
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return &conditionFailedError{*conditionExpression}
+	}
 	if err != nil {
-		panic(err)
+		return newServiceError(err)
 	}
-	fmt.Println(result)
+	return nil
 }
 
-func run(args ddbArgs) (string, error) {
-	if args.Command == "get" {
-		return get(args.Client, args.Table, args.Arguments.Attributes)
-	}
-	if args.Command == "scan" {
-		return scan(args.Client, args.Table)
+// newSession connects to DynamoDB, or to the endpoint if one is given.
+func newSession(endpoint string) *session.Session {
+	sess := session.New()
+	if endpoint != "" {
+		sess.Config.Endpoint = aws.String(endpoint)
 	}
-	return "", set(args)
+	return sess
 }
 
-func scan(c dynamodbiface.DynamoDBAPI, table string) (string, error) {
-	var items []map[string]*dynamodb.AttributeValue
-	err := c.ScanPages(&dynamodb.ScanInput{
-		TableName: &table,
-	}, func(output *dynamodb.ScanOutput, _lastPage bool) bool {
-		items = append(items, output.Items...)
-		return true
-	})
+// statementList collects every -statement flag, as batch-get accepts more
+// than one.
+type statementList []string
+
+func (s *statementList) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *statementList) Set(statement string) error {
+	*s = append(*s, statement)
+	return nil
+}
+
+// parseStatement parses a statement into one of the expression grammars, such
+// as keyCondition or updateStatement. Keywords in these grammars are case
+// insensitive, but values such as true are not.
+func parseStatement(statement string, grammar interface{}) (err error) {
+	parser, err := participle.Build(grammar, participle.CaseInsensitive("Ident"))
 	if err != nil {
-		return "", err
+		return err
 	}
+	// The lexer panics on errors such as an unterminated string.
+	defer func() {
+		if r := recover(); r != nil {
+			lexErr, ok := r.(*lexer.Error)
+			if !ok {
+				panic(r)
+			}
+			err = newParseError(statement, lexErr)
+		}
+	}()
+	if err := parser.ParseString(statement, grammar); err != nil {
+		return newParseError(statement, err)
+	}
+	return nil
+}
 
-	var serialisedResult []map[string]interface{}
-	err = dynamodbattribute.UnmarshalListOfMaps(items, &serialisedResult)
-	if err != nil {
+func run(args ddbArgs) (string, error) {
+	if err := checkKeys(args); err != nil {
 		return "", err
 	}
-	r, err := json.MarshalIndent(serialisedResult, "", "	")
-	return string(r), err
+	if args.Command == "get" {
+		return get(args)
+	}
+	if args.Command == "scan" {
+		return scan(args)
+	}
+	if args.Command == "query" {
+		return query(args)
+	}
+	if args.Command == "delete" {
+		return deleteItem(args)
+	}
+	if args.Command == "update" {
+		return update(args)
+	}
+	if args.Command == "batch-get" {
+		return batchGet(args)
+	}
+	if args.Command == "transact" {
+		return transact(args)
+	}
+	if args.Command == "import" {
+		return importItems(args)
+	}
+	if args.Command == "export" {
+		return export(args)
+	}
+	return "", set(args)
 }
 
-func get(c dynamodbiface.DynamoDBAPI, table string, attributes []*attribute) (string, error) {
+func buildKey(attributes []*attribute) (map[string]*dynamodb.AttributeValue, error) {
 	key := map[string]*dynamodb.AttributeValue{}
 
 	for _, attr := range attributes {
 		k := attr.Key
-		v := attr.Value
+		v, err := valueToAttribute(attr.Value)
+		if err != nil {
+			return nil, validationErrorf("%s: %s", k, err)
+		}
 
-		key[k] = valueToAttribute(v)
+		key[k] = v
 	}
+	return key, nil
+}
 
-	resp, err := c.GetItem(&dynamodb.GetItemInput{
-		TableName: &table,
-		Key:       key,
-	})
+func get(args ddbArgs) (string, error) {
+	key, err := buildKey(args.Arguments.Attributes)
 	if err != nil {
 		return "", err
 	}
-	var result map[string]interface{}
-	err = dynamodbattribute.UnmarshalMap(resp.Item, &result)
+	input := &dynamodb.GetItemInput{
+		TableName: &args.Table,
+		Key:       key,
+	}
+	if args.Projection != nil {
+		builder := newExpressionBuilder()
+		input.ProjectionExpression = aws.String(args.Projection.expression(builder))
+		input.ExpressionAttributeNames = builder.attributeNames()
+	}
+	resp, err := args.Client.GetItem(input)
 	if err != nil {
 		return "", err
 	}
-	r, err := json.Marshal(result)
+	return marshalItem(resp.Item, args.Format)
+}
+
+func marshalItem(item map[string]*dynamodb.AttributeValue, format string) (string, error) {
+	if format == "ddb-json" {
+		r, err := json.Marshal(itemToDynamoJSON(item))
+		return string(r), err
+	}
+	r, err := json.Marshal(itemToJSON(item))
 	return string(r), err
 }
 
+func deleteItem(args ddbArgs) (string, error) {
+	key, err := buildKey(args.Arguments.Attributes)
+	if err != nil {
+		return "", err
+	}
+	input := &dynamodb.DeleteItemInput{
+		TableName: &args.Table,
+		Key:       key,
+	}
+	if args.ReturnValues != "" {
+		input.ReturnValues = &args.ReturnValues
+	}
+	if args.Condition != nil {
+		builder := newExpressionBuilder()
+		input.ConditionExpression = aws.String(args.Condition.expression(builder))
+		if builder.err != nil {
+			return "", builder.err
+		}
+		input.ExpressionAttributeNames = builder.attributeNames()
+		input.ExpressionAttributeValues = builder.attributeValues()
+	}
+	resp, err := args.Client.DeleteItem(input)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Attributes) == 0 {
+		return "", nil
+	}
+	return marshalItem(resp.Attributes, args.Format)
+}
+
 func set(args ddbArgs) error {
-	item := make(map[string]*dynamodb.AttributeValue)
-	for _, attr := range args.Arguments.Attributes {
-		item[attr.Key] = valueToAttribute(attr.Value)
+	item, err := buildKey(args.Arguments.Attributes)
+	if err != nil {
+		return err
 	}
-	_, err := args.Client.PutItem(&dynamodb.PutItemInput{
+	input := &dynamodb.PutItemInput{
 		TableName: &args.Table,
 		Item:      item,
-	})
+	}
+	if args.Condition != nil {
+		builder := newExpressionBuilder()
+		input.ConditionExpression = aws.String(args.Condition.expression(builder))
+		if builder.err != nil {
+			return builder.err
+		}
+		input.ExpressionAttributeNames = builder.attributeNames()
+		input.ExpressionAttributeValues = builder.attributeValues()
+	}
+	_, err = args.Client.PutItem(input)
 	return err
 }
@@ -6,6 +6,8 @@ import (
 	"compress/gzip"
 	"io/ioutil"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/alecthomas/participle"
@@ -14,6 +16,11 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 )
 
+func numberPointer(n string) *number {
+	v := number(n)
+	return &v
+}
+
 func parserSetup(attributes string) (*keyValue, error) {
 	attr := &keyValue{}
 	parser, err := participle.Build(&keyValue{})
@@ -92,8 +99,8 @@ func TestParserSimpleInt(t *testing.T) {
 	if ast.Attributes[0].Key != "key" {
 		t.Errorf("Expected key to be 'key', got '%s'", ast.Attributes[0].Key)
 	}
-	if *ast.Attributes[0].Value.Number != 123 {
-		t.Errorf("Expected Value to be '123', got '%f'", *ast.Attributes[0].Value.Number)
+	if *ast.Attributes[0].Value.Number != "123" {
+		t.Errorf("Expected Value to be '123', got '%s'", *ast.Attributes[0].Value.Number)
 	}
 	if ast.Attributes[0].Value.String != nil {
 		t.Error("Expected String to be nil")
@@ -122,6 +129,22 @@ func TestParserSimpleBool(t *testing.T) {
 	}
 }
 
+func TestParserSimpleBoolFalse(t *testing.T) {
+	ast, err := parserSetup(`key=false`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Attributes) != 1 {
+		t.Fatalf("Expected one attribute, got %d", len(ast.Attributes))
+	}
+	if ast.Attributes[0].Value.Bool == nil {
+		t.Fatalf("Expected Bool to be set")
+	}
+	if *ast.Attributes[0].Value.Bool != false {
+		t.Errorf("Expected Value to be 'false', got '%v'", *ast.Attributes[0].Value.Bool)
+	}
+}
+
 func TestParserSimpleFloat(t *testing.T) {
 	ast, err := parserSetup(`key=1.2`)
 	if err != nil {
@@ -133,8 +156,39 @@ func TestParserSimpleFloat(t *testing.T) {
 	if ast.Attributes[0].Key != "key" {
 		t.Errorf("Expected key to be 'key', got '%s'", ast.Attributes[0].Key)
 	}
-	if *ast.Attributes[0].Value.Number != 1.2 {
-		t.Errorf("Expected Value to be '1.2', got '%f'", *ast.Attributes[0].Value.Number)
+	if *ast.Attributes[0].Value.Number != "1.2" {
+		t.Errorf("Expected Value to be '1.2', got '%s'", *ast.Attributes[0].Value.Number)
+	}
+}
+
+func TestParserNumberPrecision(t *testing.T) {
+	tests := []string{
+		"9780143566496123456",
+		"0.1",
+		"-42",
+		"1.2345678901234567890123456789012345678",
+		"1e120",
+		"-1.5E-7",
+	}
+	for _, n := range tests {
+		ast, err := parserSetup("key=" + n)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", n, err)
+		}
+		av, err := valueToAttribute(ast.Attributes[0].Value)
+		if err != nil {
+			t.Fatalf("Error converting %s: %s", n, err)
+		}
+		if *av.N != n {
+			t.Errorf("Expected N to be '%s', got '%s'", n, *av.N)
+		}
+	}
+}
+
+func TestParserInvalidNumber(t *testing.T) {
+	_, err := parserSetup("key=0x1F")
+	if err == nil {
+		t.Errorf("Expected an error parsing a hexadecimal number")
 	}
 }
 
@@ -159,6 +213,20 @@ func TestParserSimpleMap(t *testing.T) {
 	}
 }
 
+func TestParserMapNumberPrecision(t *testing.T) {
+	ast, err := parserSetup("key=`{\"a\":9780143566496123456,\"b\":[0.1]}`")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := *ast.Attributes[0].Value.Map
+	if *m["a"].N != "9780143566496123456" {
+		t.Errorf("Expected a to be '9780143566496123456', got '%s'", *m["a"].N)
+	}
+	if *m["b"].L[0].N != "0.1" {
+		t.Errorf("Expected b[0] to be '0.1', got '%s'", *m["b"].L[0].N)
+	}
+}
+
 func TestParserSimpleBinary(t *testing.T) {
 	ast, err := parserSetup(`key={"fixtures/binary"}`)
 	if err != nil {
@@ -185,6 +253,36 @@ func TestParserSimpleBinary(t *testing.T) {
 	}
 }
 
+func TestParserInlineBinary(t *testing.T) {
+	defer func(r *stdinReader) { stdin = r }(stdin)
+	stdin = &stdinReader{r: strings.NewReader("piped")}
+	ast := &keyValue{}
+	if err := parseStatement(`a=b64"SGVsbG8=",b=HEX"48656c6C6f",c={-},set=(b64"AQ==", hex"02", {-}),d=hex`, ast); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"a": "Hello", "b": "Hello", "c": "piped"}
+	for _, attribute := range ast.Attributes {
+		av, err := valueToAttribute(attribute.Value)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+		switch attribute.Key {
+		case "set":
+			if len(av.BS) != 3 || string(av.BS[0]) != "\x01" || string(av.BS[1]) != "\x02" || string(av.BS[2]) != "piped" {
+				t.Errorf("Expected a binary set, got %s", av)
+			}
+		case "d":
+			if av.S == nil || *av.S != "hex" {
+				t.Errorf("Expected a bare hex to be a string, got %s", av)
+			}
+		default:
+			if string(av.B) != expected[attribute.Key] {
+				t.Errorf("Expected %s to be %s, got %s", attribute.Key, expected[attribute.Key], av)
+			}
+		}
+	}
+}
+
 func TestParserMultipleStrings(t *testing.T) {
 	ast, err := parserSetup(`key="foo",bar="baz"`)
 	if err != nil {
@@ -262,8 +360,8 @@ func TestParserNumberSet(t *testing.T) {
 	if len((*ast.Attributes[0].Value).Set) != 2 {
 		t.Errorf("Expected Set to contain 2 values, got %d", len((*ast.Attributes[0].Value).Set))
 	}
-	if *(*ast.Attributes[0].Value).Set[1].Number != 45.1 {
-		t.Errorf("Expected Set's first value to be 45.1, got %f", *(*ast.Attributes[0].Value).Set[0].Number)
+	if *(*ast.Attributes[0].Value).Set[1].Number != "45.1" {
+		t.Errorf("Expected Set's first value to be 45.1, got %s", *(*ast.Attributes[0].Value).Set[0].Number)
 	}
 }
 
@@ -281,8 +379,142 @@ func TestParserList(t *testing.T) {
 	if len((*ast.Attributes[0].Value).List) != 5 {
 		t.Errorf("Expected Set to contain 2 values, got %d", len((*ast.Attributes[0].Value).Set))
 	}
-	if *(*ast.Attributes[0].Value).List[4].List[0].Number != 1 {
-		t.Errorf("Expected Set's value to be 1, got %f", *(*ast.Attributes[0].Value).List[4].List[0].Number)
+	if *(*ast.Attributes[0].Value).List[4].List[0].Number != "1" {
+		t.Errorf("Expected Set's value to be 1, got %s", *(*ast.Attributes[0].Value).List[4].List[0].Number)
+	}
+}
+
+func TestParserNull(t *testing.T) {
+	ast := &keyValue{}
+	if err := parseStatement("key=null,list=[1,null],map=`{\"a\":null}`,string=\"null\"", ast); err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Attributes) != 4 {
+		t.Fatalf("Expected four attributes, got %d", len(ast.Attributes))
+	}
+	for _, attribute := range ast.Attributes[:3] {
+		av, err := valueToAttribute(attribute.Value)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+		if attribute.Key == "key" && (av.NULL == nil || !*av.NULL) {
+			t.Errorf("Expected key to be NULL, got %s", av)
+		}
+		if attribute.Key == "list" && av.L[1].NULL == nil {
+			t.Errorf("Expected the list to contain NULL, got %s", av)
+		}
+		if attribute.Key == "map" && av.M["a"].NULL == nil {
+			t.Errorf("Expected the map to contain NULL, got %s", av)
+		}
+	}
+	if *ast.Attributes[3].Value.String != "null" {
+		t.Errorf("Expected a quoted null to be a string")
+	}
+}
+
+func TestParserValuesAreCaseSensitive(t *testing.T) {
+	ast := &keyValue{}
+	if err := parseStatement(`a=TRUE,b=False,c=NULL,d=true,e=s(1)`, ast); err != nil {
+		t.Fatal(err)
+	}
+	for _, attribute := range ast.Attributes[:3] {
+		if attribute.Value.String == nil {
+			t.Errorf("Expected %s to be a string, got %+v", attribute.Key, attribute.Value)
+		}
+	}
+	if ast.Attributes[3].Value.Bool == nil {
+		t.Errorf("Expected d to be a boolean, got %+v", ast.Attributes[3].Value)
+	}
+	if ast.Attributes[4].Value.Cast == nil {
+		t.Errorf("Expected keywords such as casts to be case insensitive, got %+v", ast.Attributes[4].Value)
+	}
+}
+
+func TestParserObject(t *testing.T) {
+	ast := &keyValue{}
+	if err := parseStatement(`m=map{name: "x", tags: ("a","b"), "two words": [1, null], inner: map{n: 1,}, empty: map{}}`, ast); err != nil {
+		t.Fatal(err)
+	}
+	av, err := valueToAttribute(ast.Attributes[0].Value)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	m := av.M
+	if len(m) != 5 || *m["name"].S != "x" || len(m["tags"].SS) != 2 || m["two words"].L[1].NULL == nil {
+		t.Errorf("Expected every type to be nested in the map, got %s", av)
+	}
+	if *m["inner"].M["n"].N != "1" || m["empty"].M == nil || len(m["empty"].M) != 0 {
+		t.Errorf("Expected nested maps, got %s", av)
+	}
+}
+
+func TestParserObjectErrors(t *testing.T) {
+	ast := &keyValue{}
+	if err := parseStatement(`m=map{a: 1, a: 2}`, ast); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := valueToAttribute(ast.Attributes[0].Value); err == nil || err.Error() != "Duplicate key a in map" {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+	if err := parseStatement(`m=map{a: ("x", 1)}`, ast); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := valueToAttribute(ast.Attributes[0].Value); err == nil || err.Error() != "a: Invalid values found in Set. Must be all strings, all numbers or all binary" {
+		t.Errorf("Expected the key of the invalid value, got %v", err)
+	}
+	if err := parseStatement(`m=map`, ast); err != nil || *ast.Attributes[0].Value.String != "map" {
+		t.Errorf("Expected map on its own to be a string, got %v", err)
+	}
+}
+
+func TestParserCast(t *testing.T) {
+	ast := &keyValue{}
+	if err := parseStatement(`id=S(0123),n=N("1e120"),tags=SS[1,"a"],ns=ns(1,"2"),raw=B("file"),ok=BOOL("true"),l=L(1,2),s=s`, ast); err != nil {
+		t.Fatal(err)
+	}
+	expected := []*dynamodb.AttributeValue{
+		{S: aws.String("0123")},
+		{N: aws.String("1e120")},
+		{SS: []*string{aws.String("1"), aws.String("a")}},
+		{NS: []*string{aws.String("1"), aws.String("2")}},
+		{B: []byte("file")},
+		{BOOL: aws.Bool(true)},
+		{L: []*dynamodb.AttributeValue{{N: aws.String("1")}, {N: aws.String("2")}}},
+		{S: aws.String("s")},
+	}
+	if len(ast.Attributes) != len(expected) {
+		t.Fatalf("Expected %d attributes, got %d", len(expected), len(ast.Attributes))
+	}
+	for i, attribute := range ast.Attributes {
+		av, err := valueToAttribute(attribute.Value)
+		if err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+		if !reflect.DeepEqual(av, expected[i]) {
+			t.Errorf("Expected %s to be %s, got %s", attribute.Key, expected[i], av)
+		}
+	}
+}
+
+func TestParserCastErrors(t *testing.T) {
+	errors := map[string]string{
+		`a=N("abc")`:    `Can't cast "abc" to N, numbers must be written in decimal`,
+		`a=BOOL("yes")`: `Can't cast "yes" to BOOL, expected true or false`,
+		`a=NS[1, "x"]`:  `Can't cast "x" to N, numbers must be written in decimal`,
+		`a=S([1])`:      "Can't cast L to S",
+		`a=S(1, 2)`:     "S takes one value in parentheses, such as S(...)",
+		`a=S[1]`:        "S takes one value in parentheses, such as S(...)",
+		`a=SS[]`:        "SS needs at least one value, DynamoDB doesn't store empty sets",
+	}
+	for statement, expected := range errors {
+		ast := &keyValue{}
+		if err := parseStatement(statement, ast); err != nil {
+			t.Fatal(err)
+		}
+		_, err := valueToAttribute(ast.Attributes[0].Value)
+		if _, ok := err.(*validationError); !ok || err.Error() != expected {
+			t.Errorf("Expected %s to fail with %s, got %v", statement, expected, err)
+		}
 	}
 }
 
@@ -297,22 +529,37 @@ func TestParserMultipleInts(t *testing.T) {
 	if ast.Attributes[0].Key != "key" {
 		t.Errorf("Expected key to be 'key', got '%s'", ast.Attributes[0].Key)
 	}
-	if *ast.Attributes[0].Value.Number != 12 {
-		t.Errorf("Expected Value to be '12', got '%f'", *ast.Attributes[0].Value.Number)
+	if *ast.Attributes[0].Value.Number != "12" {
+		t.Errorf("Expected Value to be '12', got '%s'", *ast.Attributes[0].Value.Number)
 	}
 	if ast.Attributes[1].Key != "bar" {
 		t.Errorf("Expected key to be 'bar', got '%s'", ast.Attributes[1].Key)
 	}
-	if *ast.Attributes[1].Value.Number != 2.1 {
-		t.Errorf("Expected Value to be 'baz', got '%f'", *ast.Attributes[1].Value.Number)
+	if *ast.Attributes[1].Value.Number != "2.1" {
+		t.Errorf("Expected Value to be 'baz', got '%s'", *ast.Attributes[1].Value.Number)
 	}
 }
 
 type mockDynamo struct {
 	dynamodbiface.DynamoDBAPI
+	mutex       sync.Mutex
+	getInput    *dynamodb.GetItemInput
+	scanInputs  []*dynamodb.ScanInput
+	queryInput  *dynamodb.QueryInput
+	putInput    *dynamodb.PutItemInput
+	deleteInput *dynamodb.DeleteItemInput
+	updateInput *dynamodb.UpdateItemInput
+	batchWrites []*dynamodb.BatchWriteItemInput
+	batchGets   []*dynamodb.BatchGetItemInput
+	transaction *dynamodb.TransactWriteItemsInput
+	retried     map[string]bool
+	describes   int
+	createTable *dynamodb.CreateTableInput
+	deleteTable *dynamodb.DeleteTableInput
 }
 
 func (d *mockDynamo) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	d.getInput = input
 	return &dynamodb.GetItemOutput{
 		Item: map[string]*dynamodb.AttributeValue{
 			"string": {
@@ -325,10 +572,25 @@ func (d *mockDynamo) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOut
 	}, nil
 }
 
-func (d *mockDynamo) PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (d *mockDynamo) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	d.putInput = input
 	return &dynamodb.PutItemOutput{}, nil
 }
 
+func (d *mockDynamo) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	d.deleteInput = input
+	if input.ReturnValues == nil || *input.ReturnValues != "ALL_OLD" {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	return &dynamodb.DeleteItemOutput{
+		Attributes: map[string]*dynamodb.AttributeValue{
+			"string": {
+				S: aws.String("bar"),
+			},
+		},
+	}, nil
+}
+
 func TestGetString(t *testing.T) {
 	args := ddbArgs{
 		Client:  &mockDynamo{},
@@ -354,6 +616,32 @@ func TestGetString(t *testing.T) {
 	}
 }
 
+func TestGetDynamoJSON(t *testing.T) {
+	args := ddbArgs{
+		Client:  &mockDynamo{},
+		Command: "get",
+		Arguments: &keyValue{
+			Attributes: []*attribute{
+				{
+					Key: "string",
+					Value: &value{
+						String: aws.String("bar"),
+					},
+				},
+			},
+		},
+		Table:  "testing",
+		Format: "ddb-json",
+	}
+	output, err := run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if output != `{"number":{"N":"123.4"},"string":{"S":"bar"}}` {
+		t.Errorf("Expected result to be DynamoDB JSON, got '%s'", output)
+	}
+}
+
 func TestGetWithSortKey(t *testing.T) {
 	args := ddbArgs{
 		Client:  &mockDynamo{},
@@ -385,6 +673,108 @@ func TestGetWithSortKey(t *testing.T) {
 	}
 }
 
+func TestGetWithProjection(t *testing.T) {
+	client := &mockDynamo{}
+	args := ddbArgs{
+		Client:  client,
+		Command: "get",
+		Arguments: &keyValue{
+			Attributes: []*attribute{
+				{
+					Key: "string",
+					Value: &value{
+						String: aws.String("bar"),
+					},
+				},
+			},
+		},
+		Projection: &projection{
+			Paths: []*documentPath{
+				{Name: "string"},
+				{Name: "number"},
+			},
+		},
+		Table: "testing",
+	}
+	_, err := run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.getInput.ProjectionExpression != "#n0, #n1" {
+		t.Errorf("Unexpected ProjectionExpression '%s'", *client.getInput.ProjectionExpression)
+	}
+	if *client.getInput.ExpressionAttributeNames["#n1"] != "number" {
+		t.Errorf("Expected #n1 to be 'number', got '%s'", *client.getInput.ExpressionAttributeNames["#n1"])
+	}
+}
+
+func TestDelete(t *testing.T) {
+	client := &mockDynamo{}
+	args := ddbArgs{
+		Client:  client,
+		Command: "delete",
+		Arguments: &keyValue{
+			Attributes: []*attribute{
+				{
+					Key: "partition",
+					Value: &value{
+						String: aws.String("foo"),
+					},
+				},
+				{
+					Key: "sort",
+					Value: &value{
+						String: aws.String("bar"),
+					},
+				},
+			},
+		},
+		Table: "testing",
+	}
+	output, err := run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if output != "" {
+		t.Errorf("Expected no output, got '%s'", output)
+	}
+	if len(client.deleteInput.Key) != 2 {
+		t.Errorf("Expected Key to contain 2 attributes, got %d", len(client.deleteInput.Key))
+	}
+	if *client.deleteInput.Key["sort"].S != "bar" {
+		t.Errorf("Expected sort key to be 'bar', got '%s'", *client.deleteInput.Key["sort"].S)
+	}
+	if client.deleteInput.ReturnValues != nil {
+		t.Errorf("Expected ReturnValues to be nil, got '%s'", *client.deleteInput.ReturnValues)
+	}
+}
+
+func TestDeleteReturnOldValues(t *testing.T) {
+	args := ddbArgs{
+		Client:  &mockDynamo{},
+		Command: "delete",
+		Arguments: &keyValue{
+			Attributes: []*attribute{
+				{
+					Key: "string",
+					Value: &value{
+						String: aws.String("bar"),
+					},
+				},
+			},
+		},
+		Table:        "testing",
+		ReturnValues: "ALL_OLD",
+	}
+	output, err := run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if output != `{"string":"bar"}` {
+		t.Errorf("Expected result to be the deleted item, got '%s'", output)
+	}
+}
+
 func TestSetStringSet(t *testing.T) {
 	args := ddbArgs{
 		Client:  &mockDynamo{},
@@ -507,7 +897,7 @@ func TestSetList(t *testing.T) {
 								String: aws.String("foo"),
 							},
 							{
-								Number: aws.Float64(1),
+								Number: numberPointer("1"),
 							},
 						},
 					},
@@ -541,7 +931,7 @@ func TestSetNestedList(t *testing.T) {
 										String: aws.String("bar"),
 									},
 									{
-										Number: aws.Float64(12.0),
+										Number: numberPointer("12.0"),
 									},
 								},
 							},
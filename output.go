@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// itemWriter writes each page of items as it is read, so that memory use
+// does not grow with the size of a scan or query.
+type itemWriter interface {
+	Write(items []map[string]*dynamodb.AttributeValue) error
+	Close() error
+}
+
+func newItemWriter(w io.Writer, format string) (itemWriter, error) {
+	switch format {
+	case "", "json":
+		return &jsonArrayWriter{w: bufio.NewWriter(w)}, nil
+	case "jsonl":
+		return &jsonLinesWriter{w: bufio.NewWriter(w), encode: itemToJSON}, nil
+	case "ddb-json":
+		return &jsonLinesWriter{w: bufio.NewWriter(w), encode: itemToDynamoJSON}, nil
+	}
+	return nil, fmt.Errorf("Unknown output format %s, expected json, jsonl or ddb-json", format)
+}
+
+// jsonArrayWriter writes items as an indented JSON array.
+type jsonArrayWriter struct {
+	w       *bufio.Writer
+	started bool
+}
+
+func (j *jsonArrayWriter) Write(items []map[string]*dynamodb.AttributeValue) error {
+	for _, item := range items {
+		r, err := json.MarshalIndent(itemToJSON(item), "	", "	")
+		if err != nil {
+			return err
+		}
+		if j.started {
+			j.w.WriteString(",\n	")
+		} else {
+			j.w.WriteString("[\n	")
+			j.started = true
+		}
+		j.w.Write(r)
+	}
+	return j.w.Flush()
+}
+
+func (j *jsonArrayWriter) Close() error {
+	if j.started {
+		j.w.WriteString("\n]\n")
+	} else {
+		j.w.WriteString("[]\n")
+	}
+	return j.w.Flush()
+}
+
+// jsonLinesWriter writes one JSON object per line, encoded either as plain
+// JSON or as DynamoDB JSON.
+type jsonLinesWriter struct {
+	w      *bufio.Writer
+	encode func(map[string]*dynamodb.AttributeValue) map[string]interface{}
+}
+
+func (j *jsonLinesWriter) Write(items []map[string]*dynamodb.AttributeValue) error {
+	for _, item := range items {
+		r, err := json.Marshal(j.encode(item))
+		if err != nil {
+			return err
+		}
+		j.w.Write(r)
+		j.w.WriteString("\n")
+	}
+	return j.w.Flush()
+}
+
+func (j *jsonLinesWriter) Close() error {
+	return j.w.Flush()
+}
+
+// itemToJSON converts an item into values that encoding/json can marshal.
+// Numbers are converted to json.Number so they are printed exactly as
+// DynamoDB returned them, rather than being rounded through a float64.
+func itemToJSON(item map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	if item == nil {
+		return nil
+	}
+	result := map[string]interface{}{}
+	for k, v := range item {
+		result[k] = attributeToJSON(v)
+	}
+	return result
+}
+
+func attributeToJSON(av *dynamodb.AttributeValue) interface{} {
+	switch {
+	case av.S != nil:
+		return *av.S
+	case av.N != nil:
+		return json.Number(*av.N)
+	case av.BOOL != nil:
+		return *av.BOOL
+	case av.B != nil:
+		return av.B
+	case av.SS != nil:
+		return aws.StringValueSlice(av.SS)
+	case av.NS != nil:
+		numbers := []json.Number{}
+		for _, n := range av.NS {
+			numbers = append(numbers, json.Number(*n))
+		}
+		return numbers
+	case av.BS != nil:
+		return av.BS
+	case av.L != nil:
+		list := []interface{}{}
+		for _, v := range av.L {
+			list = append(list, attributeToJSON(v))
+		}
+		return list
+	case av.M != nil:
+		return itemToJSON(av.M)
+	}
+	return nil
+}
+
+// itemToDynamoJSON converts an item into the DynamoDB JSON wire format, such
+// as {"S": "foo"}, which keeps every type intact. Binary values are base64
+// encoded by encoding/json, as they are on the wire.
+func itemToDynamoJSON(item map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	if item == nil {
+		return nil
+	}
+	result := map[string]interface{}{}
+	for k, v := range item {
+		result[k] = attributeToDynamoJSON(v)
+	}
+	return result
+}
+
+func attributeToDynamoJSON(av *dynamodb.AttributeValue) map[string]interface{} {
+	switch {
+	case av.S != nil:
+		return map[string]interface{}{"S": *av.S}
+	case av.N != nil:
+		return map[string]interface{}{"N": *av.N}
+	case av.BOOL != nil:
+		return map[string]interface{}{"BOOL": *av.BOOL}
+	case av.NULL != nil:
+		return map[string]interface{}{"NULL": *av.NULL}
+	case av.B != nil:
+		return map[string]interface{}{"B": av.B}
+	case av.SS != nil:
+		return map[string]interface{}{"SS": aws.StringValueSlice(av.SS)}
+	case av.NS != nil:
+		return map[string]interface{}{"NS": aws.StringValueSlice(av.NS)}
+	case av.BS != nil:
+		return map[string]interface{}{"BS": av.BS}
+	case av.L != nil:
+		list := []interface{}{}
+		for _, v := range av.L {
+			list = append(list, attributeToDynamoJSON(v))
+		}
+		return map[string]interface{}{"L": list}
+	case av.M != nil:
+		return map[string]interface{}{"M": itemToDynamoJSON(av.M)}
+	}
+	return map[string]interface{}{}
+}
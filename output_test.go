@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var outputPages = [][]map[string]*dynamodb.AttributeValue{
+	{
+		{"a": {S: aws.String("foo")}},
+		{"a": {S: aws.String("bar")}},
+	},
+	{},
+	{
+		{"a": {N: aws.String("1")}},
+	},
+}
+
+func writeItems(t *testing.T, format string, pages [][]map[string]*dynamodb.AttributeValue) string {
+	output := &bytes.Buffer{}
+	writer, err := newItemWriter(output, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		if err := writer.Write(page); err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	return output.String()
+}
+
+func TestJSONArrayWriter(t *testing.T) {
+	expected := `[
+	{
+		"a": "foo"
+	},
+	{
+		"a": "bar"
+	},
+	{
+		"a": 1
+	}
+]
+`
+	if output := writeItems(t, "json", outputPages); output != expected {
+		t.Errorf("Expected output to be %s, got %s", expected, output)
+	}
+}
+
+func TestJSONArrayWriterEmpty(t *testing.T) {
+	if output := writeItems(t, "json", nil); output != "[]\n" {
+		t.Errorf("Expected output to be an empty array, got %s", output)
+	}
+}
+
+func TestJSONArrayWriterStreams(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer, err := newItemWriter(output, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(outputPages[0]); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expected := `[
+	{
+		"a": "foo"
+	},
+	{
+		"a": "bar"
+	}`
+	if output.String() != expected {
+		t.Errorf("Expected the first page to be written before Close, got %s", output)
+	}
+}
+
+func TestJSONLinesWriter(t *testing.T) {
+	expected := `{"a":"foo"}
+{"a":"bar"}
+{"a":1}
+`
+	if output := writeItems(t, "jsonl", outputPages); output != expected {
+		t.Errorf("Expected output to be %s, got %s", expected, output)
+	}
+}
+
+func TestUnknownOutputFormat(t *testing.T) {
+	if _, err := newItemWriter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("Expected an error for an unknown output format")
+	}
+}
+
+func TestJSONLinesWriterNumberPrecision(t *testing.T) {
+	pages := [][]map[string]*dynamodb.AttributeValue{
+		{
+			{
+				"big":   {N: aws.String("9780143566496123456")},
+				"small": {N: aws.String("0.1000000000000000000000000000000000001")},
+				"set":   {NS: []*string{aws.String("12345678901234567890")}},
+			},
+		},
+	}
+	expected := `{"big":9780143566496123456,"set":[12345678901234567890],"small":0.1000000000000000000000000000000000001}
+`
+	if output := writeItems(t, "jsonl", pages); output != expected {
+		t.Errorf("Expected output to be %s, got %s", expected, output)
+	}
+}
+
+func TestDynamoJSONWriter(t *testing.T) {
+	pages := [][]map[string]*dynamodb.AttributeValue{
+		{
+			{
+				"string":    {S: aws.String("foo")},
+				"number":    {N: aws.String("9780143566496123456")},
+				"bool":      {BOOL: aws.Bool(false)},
+				"null":      {NULL: aws.Bool(true)},
+				"binary":    {B: []byte("Hello")},
+				"stringSet": {SS: []*string{aws.String("a"), aws.String("b")}},
+				"numberSet": {NS: []*string{aws.String("1"), aws.String("2")}},
+				"binarySet": {BS: [][]byte{[]byte("Hello")}},
+				"list":      {L: []*dynamodb.AttributeValue{{S: aws.String("a")}, {N: aws.String("1")}}},
+				"map":       {M: map[string]*dynamodb.AttributeValue{"a": {S: aws.String("b")}}},
+			},
+		},
+		{
+			{"string": {S: aws.String("bar")}},
+		},
+	}
+	expected := `{"binary":{"B":"SGVsbG8="},"binarySet":{"BS":["SGVsbG8="]},"bool":{"BOOL":false},"list":{"L":[{"S":"a"},{"N":"1"}]},"map":{"M":{"a":{"S":"b"}}},"null":{"NULL":true},"number":{"N":"9780143566496123456"},"numberSet":{"NS":["1","2"]},"string":{"S":"foo"},"stringSet":{"SS":["a","b"]}}
+{"string":{"S":"bar"}}
+`
+	if output := writeItems(t, "ddb-json", pages); output != expected {
+		t.Errorf("Expected output to be %s, got %s", expected, output)
+	}
+}
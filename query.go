@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type keyCondition struct {
+	Partition *attribute     `@@`
+	Sort      *sortCondition `[ "," @@ ]`
+}
+
+type sortCondition struct {
+	BeginsWith *beginsWith `  @@`
+	Key        string      `| @Ident`
+	Operator   string      `  ( @( "=" | "<" [ "=" ] | ">" [ "=" ] )`
+	Value      *value      `    @@`
+	Between    []*value    `  | "between" @@ "and" @@ )`
+}
+
+type beginsWith struct {
+	Key    string `"begins_with" "(" @Ident ","`
+	Prefix *value `@@ ")"`
+}
+
+func (k *keyCondition) expression(e *expressionBuilder) string {
+	partition := fmt.Sprintf("%s = %s", e.name(k.Partition.Key), e.literal(k.Partition.Value))
+	if k.Sort == nil {
+		return partition
+	}
+	return fmt.Sprintf("%s AND %s", partition, k.Sort.expression(e))
+}
+
+func (s *sortCondition) expression(e *expressionBuilder) string {
+	switch {
+	case s.BeginsWith != nil:
+		return fmt.Sprintf("begins_with(%s, %s)", e.name(s.BeginsWith.Key), e.literal(s.BeginsWith.Prefix))
+	case s.Between != nil:
+		return fmt.Sprintf("%s BETWEEN %s AND %s", e.name(s.Key), e.literal(s.Between[0]), e.literal(s.Between[1]))
+	}
+	return fmt.Sprintf("%s %s %s", e.name(s.Key), s.Operator, e.literal(s.Value))
+}
+
+func query(args ddbArgs) (string, error) {
+	builder := newExpressionBuilder()
+	input := &dynamodb.QueryInput{
+		TableName:              &args.Table,
+		KeyConditionExpression: aws.String(args.KeyCondition.expression(builder)),
+	}
+	if args.Index != "" {
+		input.IndexName = aws.String(args.Index)
+	}
+	if args.Filter != nil {
+		input.FilterExpression = aws.String(args.Filter.expression(builder))
+	}
+	if args.Projection != nil {
+		input.ProjectionExpression = aws.String(args.Projection.expression(builder))
+	}
+	if builder.err != nil {
+		return "", builder.err
+	}
+	input.ExpressionAttributeNames = builder.attributeNames()
+	input.ExpressionAttributeValues = builder.attributeValues()
+
+	writer, err := newItemWriter(args.Output, args.Format)
+	if err != nil {
+		return "", err
+	}
+	var writeErr error
+	err = args.Client.QueryPages(input, func(output *dynamodb.QueryOutput, _lastPage bool) bool {
+		writeErr = writer.Write(output.Items)
+		return writeErr == nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if writeErr != nil {
+		return "", writeErr
+	}
+	return "", writer.Close()
+}
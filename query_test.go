@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func keyConditionSetup(statement string) (*keyCondition, error) {
+	condition := &keyCondition{}
+	err := parseStatement(statement, condition)
+	return condition, err
+}
+
+func (d *mockDynamo) QueryPages(input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+	d.queryInput = input
+	fn(&dynamodb.QueryOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"partition": {S: aws.String("foo")},
+				"sort":      {N: aws.String("1")},
+			},
+		},
+	}, false)
+	fn(&dynamodb.QueryOutput{
+		Items: []map[string]*dynamodb.AttributeValue{
+			{
+				"partition": {S: aws.String("foo")},
+				"sort":      {N: aws.String("2")},
+			},
+		},
+	}, true)
+	return nil
+}
+
+func TestParserKeyConditionPartitionOnly(t *testing.T) {
+	ast, err := keyConditionSetup(`partition="foo"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.Partition.Key != "partition" {
+		t.Errorf("Expected key to be 'partition', got '%s'", ast.Partition.Key)
+	}
+	if *ast.Partition.Value.String != "foo" {
+		t.Errorf("Expected Value to be 'foo', got '%s'", *ast.Partition.Value.String)
+	}
+	if ast.Sort != nil {
+		t.Errorf("Expected Sort to be nil")
+	}
+}
+
+func TestKeyConditionExpressions(t *testing.T) {
+	tests := []struct {
+		statement  string
+		expression string
+	}{
+		{`partition="foo"`, "#n0 = :v0"},
+		{`partition="foo",sort=1`, "#n0 = :v0 AND #n1 = :v1"},
+		{`partition="foo",sort<1`, "#n0 = :v0 AND #n1 < :v1"},
+		{`partition="foo",sort<=1`, "#n0 = :v0 AND #n1 <= :v1"},
+		{`partition="foo",sort>1`, "#n0 = :v0 AND #n1 > :v1"},
+		{`partition="foo",sort>=1`, "#n0 = :v0 AND #n1 >= :v1"},
+		{`partition="foo",sort between 1 and 5`, "#n0 = :v0 AND #n1 BETWEEN :v1 AND :v2"},
+		{`partition="foo",sort BETWEEN 1 AND 5`, "#n0 = :v0 AND #n1 BETWEEN :v1 AND :v2"},
+		{`partition="foo",begins_with(sort,"ba")`, "#n0 = :v0 AND begins_with(#n1, :v1)"},
+	}
+	for _, test := range tests {
+		ast, err := keyConditionSetup(test.statement)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", test.statement, err)
+		}
+		expression := ast.expression(newExpressionBuilder())
+		if expression != test.expression {
+			t.Errorf("Expected expression for %s to be '%s', got '%s'", test.statement, test.expression, expression)
+		}
+	}
+}
+
+func TestParserKeyConditionInvalidOperator(t *testing.T) {
+	_, err := keyConditionSetup(`partition="foo",sort<>1`)
+	if err == nil {
+		t.Error("Expected an error parsing '<>' in a key condition")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	client := &mockDynamo{}
+	condition, err := keyConditionSetup(`partition="foo",sort between 1 and 5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := &bytes.Buffer{}
+	args := ddbArgs{
+		Client:       client,
+		Command:      "query",
+		KeyCondition: condition,
+		Table:        "testing",
+		Output:       output,
+	}
+	_, err = run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expected := `[
+	{
+		"partition": "foo",
+		"sort": 1
+	},
+	{
+		"partition": "foo",
+		"sort": 2
+	}
+]
+`
+	if output.String() != expected {
+		t.Errorf("Expected result to be %s, got %s", expected, output)
+	}
+	if *client.queryInput.TableName != "testing" {
+		t.Errorf("Expected TableName to be 'testing', got '%s'", *client.queryInput.TableName)
+	}
+	if *client.queryInput.ExpressionAttributeNames["#n1"] != "sort" {
+		t.Errorf("Expected #n1 to be 'sort', got '%s'", *client.queryInput.ExpressionAttributeNames["#n1"])
+	}
+	if *client.queryInput.ExpressionAttributeValues[":v2"].N != "5" {
+		t.Errorf("Expected :v2 to be 5, got '%s'", *client.queryInput.ExpressionAttributeValues[":v2"].N)
+	}
+}
+
+func TestQueryWithFilter(t *testing.T) {
+	client := &mockDynamo{}
+	condition, err := keyConditionSetup(`partition="foo"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := conditionSetup(`size(tags) > 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(ddbArgs{
+		Client:       client,
+		Command:      "query",
+		KeyCondition: condition,
+		Filter:       filter,
+		Table:        "testing",
+		Output:       &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.queryInput.KeyConditionExpression != "#n0 = :v0" {
+		t.Errorf("Unexpected KeyConditionExpression '%s'", *client.queryInput.KeyConditionExpression)
+	}
+	if *client.queryInput.FilterExpression != "size(#n1) > :v1" {
+		t.Errorf("Unexpected FilterExpression '%s'", *client.queryInput.FilterExpression)
+	}
+}
+
+func TestQueryWithProjection(t *testing.T) {
+	client := &mockDynamo{}
+	condition, err := keyConditionSetup(`partition="foo"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := &projection{}
+	if err := parseStatement(`sort, partition`, project); err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(ddbArgs{
+		Client:       client,
+		Command:      "query",
+		KeyCondition: condition,
+		Projection:   project,
+		Table:        "testing",
+		Output:       &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.queryInput.ProjectionExpression != "#n1, #n0" {
+		t.Errorf("Unexpected ProjectionExpression '%s'", *client.queryInput.ProjectionExpression)
+	}
+}
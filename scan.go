@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func scan(args ddbArgs) (string, error) {
+	writer, err := newItemWriter(args.Output, args.Format)
+	if err != nil {
+		return "", err
+	}
+	if err := scanInto(args, writer); err != nil {
+		return "", err
+	}
+	return "", writer.Close()
+}
+
+// scanInto reads the whole table into writer. With more than one segment,
+// each segment is scanned by its own goroutine and pages are written as they
+// arrive, so the order of items in the output is not deterministic.
+func scanInto(args ddbArgs, writer itemWriter) error {
+	segments := args.Segments
+	if segments < 1 {
+		segments = 1
+	}
+	if segments > 1 {
+		writer = &syncItemWriter{writer: writer}
+	}
+
+	var stopped int32
+	errs := make(chan error, segments)
+	for segment := 0; segment < segments; segment++ {
+		go func(segment int) {
+			err := scanSegment(args, writer, segment, segments, &stopped)
+			if err != nil {
+				atomic.StoreInt32(&stopped, 1)
+			}
+			errs <- err
+		}(segment)
+	}
+
+	var scanErr error
+	for i := 0; i < segments; i++ {
+		if err := <-errs; err != nil && scanErr == nil {
+			scanErr = err
+		}
+	}
+	return scanErr
+}
+
+func scanSegment(args ddbArgs, writer itemWriter, segment, totalSegments int, stopped *int32) error {
+	input := &dynamodb.ScanInput{
+		TableName: &args.Table,
+	}
+	if args.Index != "" {
+		input.IndexName = aws.String(args.Index)
+	}
+	if totalSegments > 1 {
+		input.Segment = aws.Int64(int64(segment))
+		input.TotalSegments = aws.Int64(int64(totalSegments))
+	}
+	builder := newExpressionBuilder()
+	if args.Filter != nil {
+		input.FilterExpression = aws.String(args.Filter.expression(builder))
+	}
+	if args.Projection != nil {
+		input.ProjectionExpression = aws.String(args.Projection.expression(builder))
+	}
+	if builder.err != nil {
+		return builder.err
+	}
+	input.ExpressionAttributeNames = builder.attributeNames()
+	input.ExpressionAttributeValues = builder.attributeValues()
+
+	count := 0
+	var writeErr error
+	err := args.Client.ScanPages(input, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		writeErr = writer.Write(output.Items)
+		count += len(output.Items)
+		if totalSegments > 1 && args.Progress != nil {
+			status := "scanning"
+			if lastPage {
+				status = "done"
+			}
+			fmt.Fprintf(args.Progress, "segment %d/%d: %d items, %s\n", segment+1, totalSegments, count, status)
+		}
+		return writeErr == nil && atomic.LoadInt32(stopped) == 0
+	})
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// syncItemWriter serialises writes from concurrent scan segments. Each page
+// is written while holding the lock, so pages are never interleaved.
+type syncItemWriter struct {
+	mutex  sync.Mutex
+	writer itemWriter
+}
+
+func (s *syncItemWriter) Write(items []map[string]*dynamodb.AttributeValue) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.writer.Write(items)
+}
+
+func (s *syncItemWriter) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.writer.Close()
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// ScanPages returns two pages for each segment, with the items labelled by
+// the segment that returned them.
+func (d *mockDynamo) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	d.mutex.Lock()
+	d.scanInputs = append(d.scanInputs, input)
+	d.mutex.Unlock()
+
+	if input.TotalSegments == nil {
+		fn(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"string": {S: aws.String("foo")},
+				},
+				{
+					"string": {S: aws.String("bar")},
+				},
+			},
+		}, true)
+		return nil
+	}
+	segment := aws.Int64Value(input.Segment)
+	if segment == 2 {
+		return errors.New("Segment failed")
+	}
+	for page := int64(0); page < 2; page++ {
+		more := fn(&dynamodb.ScanOutput{
+			Items: []map[string]*dynamodb.AttributeValue{
+				{
+					"segment": {N: aws.String(strconv.FormatInt(segment, 10))},
+					"page":    {N: aws.String(strconv.FormatInt(page, 10))},
+				},
+			},
+		}, page == 1)
+		if !more {
+			break
+		}
+	}
+	return nil
+}
+
+func TestScan(t *testing.T) {
+	client := &mockDynamo{}
+	output := &bytes.Buffer{}
+	_, err := run(ddbArgs{
+		Client:  client,
+		Command: "scan",
+		Table:   "testing",
+		Output:  output,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	expected := `[
+	{
+		"string": "foo"
+	},
+	{
+		"string": "bar"
+	}
+]
+`
+	if output.String() != expected {
+		t.Errorf("Expected result to be %s, got %s", expected, output)
+	}
+	if client.scanInputs[0].FilterExpression != nil {
+		t.Errorf("Expected no FilterExpression, got '%s'", *client.scanInputs[0].FilterExpression)
+	}
+	if client.scanInputs[0].Segment != nil {
+		t.Errorf("Expected no Segment, got %d", *client.scanInputs[0].Segment)
+	}
+}
+
+func TestScanWithFilter(t *testing.T) {
+	client := &mockDynamo{}
+	filter := &condition{}
+	err := parseStatement(`status in ("active", "pending") and not attribute_exists(deleted)`, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(ddbArgs{
+		Client:  client,
+		Command: "scan",
+		Table:   "testing",
+		Filter:  filter,
+		Output:  &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.scanInputs[0].FilterExpression != "#n0 IN (:v0, :v1) AND NOT attribute_exists(#n1)" {
+		t.Errorf("Unexpected FilterExpression '%s'", *client.scanInputs[0].FilterExpression)
+	}
+	if *client.scanInputs[0].ExpressionAttributeValues[":v1"].S != "pending" {
+		t.Errorf("Expected :v1 to be 'pending', got '%s'", *client.scanInputs[0].ExpressionAttributeValues[":v1"].S)
+	}
+}
+
+func TestScanWithProjectionAndFilter(t *testing.T) {
+	client := &mockDynamo{}
+	filter, err := conditionSetup(`size(tags) > 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := &projection{}
+	if err := parseStatement(`name, tags[0]`, project); err != nil {
+		t.Fatal(err)
+	}
+	_, err = run(ddbArgs{
+		Client:     client,
+		Command:    "scan",
+		Table:      "testing",
+		Filter:     filter,
+		Projection: project,
+		Output:     &bytes.Buffer{},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.scanInputs[0].FilterExpression != "size(#n0) > :v0" {
+		t.Errorf("Unexpected FilterExpression '%s'", *client.scanInputs[0].FilterExpression)
+	}
+	if *client.scanInputs[0].ProjectionExpression != "#n1, #n0[0]" {
+		t.Errorf("Unexpected ProjectionExpression '%s'", *client.scanInputs[0].ProjectionExpression)
+	}
+}
+
+func TestScanSegments(t *testing.T) {
+	client := &mockDynamo{}
+	output := &bytes.Buffer{}
+	progress := &bytes.Buffer{}
+	_, err := run(ddbArgs{
+		Client:   client,
+		Command:  "scan",
+		Table:    "testing",
+		Segments: 2,
+		Output:   output,
+		Progress: progress,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+
+	var items []map[string]int
+	if err := json.Unmarshal(output.Bytes(), &items); err != nil {
+		t.Fatalf("Expected output to be a JSON array, got %s", output)
+	}
+	if len(items) != 4 {
+		t.Fatalf("Expected 4 items, got %d", len(items))
+	}
+	var segments []int
+	for _, input := range client.scanInputs {
+		if *input.TotalSegments != 2 {
+			t.Errorf("Expected TotalSegments to be 2, got %d", *input.TotalSegments)
+		}
+		segments = append(segments, int(*input.Segment))
+	}
+	sort.Ints(segments)
+	if len(segments) != 2 || segments[0] != 0 || segments[1] != 1 {
+		t.Errorf("Expected segments 0 and 1 to be scanned, got %v", segments)
+	}
+	for _, line := range []string{"segment 1/2: 2 items, done", "segment 2/2: 2 items, done"} {
+		if !strings.Contains(progress.String(), line) {
+			t.Errorf("Expected progress to contain '%s', got %s", line, progress)
+		}
+	}
+}
+
+func TestScanSegmentError(t *testing.T) {
+	_, err := run(ddbArgs{
+		Client:   &mockDynamo{},
+		Command:  "scan",
+		Table:    "testing",
+		Segments: 3,
+		Output:   &bytes.Buffer{},
+	})
+	if err == nil || err.Error() != "Segment failed" {
+		t.Errorf("Expected the failed segment's error, got %v", err)
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// schemaMaxAge is how long a key schema is read from the cache before the
+// table is described again.
+const schemaMaxAge = 24 * time.Hour
+
+// schemaCache looks up the key schema of tables with DescribeTable, keeping
+// them in a directory so that every command doesn't have to describe the
+// table first. The directory is optional.
+type schemaCache struct {
+	client dynamodbiface.DynamoDBAPI
+	dir    string
+	tables map[string]*tableSchema
+	// described is the tables described by this process, whose schemas
+	// aren't described again when a check fails.
+	described map[string]bool
+}
+
+func newSchemaCache(client dynamodbiface.DynamoDBAPI, dir string) *schemaCache {
+	return &schemaCache{client: client, dir: dir, tables: map[string]*tableSchema{}, described: map[string]bool{}}
+}
+
+var unsafeFileName = regexp.MustCompile(`[^\w.-]+`)
+
+// schemaCacheDir returns the directory schemas are cached in for an endpoint
+// or region, as the same table name may have a different key in each.
+func schemaCacheDir(endpoint, region string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	scope := region
+	if endpoint != "" {
+		scope = endpoint
+	}
+	if scope == "" {
+		scope = "default"
+	}
+	return filepath.Join(dir, "ddb", "schemas", unsafeFileName.ReplaceAllString(scope, "_"))
+}
+
+func (c *schemaCache) file(table string) string {
+	return filepath.Join(c.dir, unsafeFileName.ReplaceAllString(table, "_")+".json")
+}
+
+// tableSchema is the key schema of a table and its indexes, as cached.
+type tableSchema struct {
+	KeySchema []exportKey             `json:"keySchema"`
+	Indexes   map[string]*indexSchema `json:"indexes,omitempty"`
+}
+
+// indexSchema is the key schema of a secondary index, and the attributes
+// projected into it.
+type indexSchema struct {
+	Global           bool        `json:"global"`
+	KeySchema        []exportKey `json:"keySchema"`
+	Projection       string      `json:"projection"`
+	NonKeyAttributes []string    `json:"nonKeyAttributes,omitempty"`
+}
+
+func newTableSchema(table *dynamodb.TableDescription) *tableSchema {
+	schema := &tableSchema{KeySchema: keySchema(table), Indexes: map[string]*indexSchema{}}
+	add := func(name *string, global bool, elements []*dynamodb.KeySchemaElement, projection *dynamodb.Projection) {
+		index := &indexSchema{Global: global, KeySchema: keyElements(table, elements)}
+		if projection != nil {
+			index.Projection = aws.StringValue(projection.ProjectionType)
+			index.NonKeyAttributes = aws.StringValueSlice(projection.NonKeyAttributes)
+		}
+		schema.Indexes[aws.StringValue(name)] = index
+	}
+	for _, index := range table.GlobalSecondaryIndexes {
+		add(index.IndexName, true, index.KeySchema, index.Projection)
+	}
+	for _, index := range table.LocalSecondaryIndexes {
+		add(index.IndexName, false, index.KeySchema, index.Projection)
+	}
+	return schema
+}
+
+// schema returns the schema of a table. Unless refresh is set, a schema read
+// before is used, and cached reports whether it was.
+func (c *schemaCache) schema(table string, refresh bool) (schema *tableSchema, cached bool, err error) {
+	if !refresh {
+		if schema, ok := c.tables[table]; ok {
+			return schema, !c.described[table], nil
+		}
+		if schema := c.read(table); schema != nil {
+			c.tables[table] = schema
+			return schema, true, nil
+		}
+	}
+	resp, err := c.client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	schema = newTableSchema(resp.Table)
+	c.tables[table] = schema
+	c.described[table] = true
+	c.write(table, schema)
+	return schema, false, nil
+}
+
+// read returns the cached schema of a table, or nil if it isn't cached or
+// is too old.
+func (c *schemaCache) read(table string) *tableSchema {
+	if c.dir == "" {
+		return nil
+	}
+	info, err := os.Stat(c.file(table))
+	if err != nil || time.Since(info.ModTime()) > schemaMaxAge {
+		return nil
+	}
+	raw, err := ioutil.ReadFile(c.file(table))
+	if err != nil {
+		return nil
+	}
+	var schema tableSchema
+	if err := json.Unmarshal(raw, &schema); err != nil || len(schema.KeySchema) == 0 {
+		return nil
+	}
+	return &schema
+}
+
+// write caches the schema of a table. It is only a cache, so errors are
+// ignored.
+func (c *schemaCache) write(table string, schema *tableSchema) {
+	if c.dir == "" {
+		return
+	}
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0755); err == nil {
+		ioutil.WriteFile(c.file(table), raw, 0644)
+	}
+}
+
+// forget removes a table from the cache, once it has been created or
+// deleted.
+func (c *schemaCache) forget(table string) {
+	delete(c.tables, table)
+	if c.dir != "" {
+		os.Remove(c.file(table))
+	}
+}
+
+// checkKey checks that the attributes hold the key of a table, with the right
+// types. Numbers are converted to strings, and strings that are numbers to
+// numbers, if the key needs them. If item is set the attributes are a whole
+// item, which may have other attributes too.
+func (c *schemaCache) checkKey(table string, attributes []*attribute, item bool) error {
+	return c.check(table, func(schema *tableSchema) error {
+		return matchKey(table, schema.KeySchema, attributes, item)
+	})
+}
+
+// checkItem checks that an item being imported has the key of the table,
+// converting key values like coerceKey. It returns the item's keyIdentity,
+// so that items with the same key can be found.
+func (c *schemaCache) checkItem(table string, item map[string]*dynamodb.AttributeValue) (string, error) {
+	var key string
+	err := c.check(table, func(schema *tableSchema) error {
+		var attributes []*attribute
+		for _, k := range schema.KeySchema {
+			if av, ok := item[k.AttributeName]; ok {
+				attributes = append(attributes, &attribute{Key: k.AttributeName, Value: attributeToValue(av)})
+			}
+		}
+		if err := matchKey(table, schema.KeySchema, attributes, true); err != nil {
+			return err
+		}
+		var names []string
+		for _, a := range attributes {
+			av, err := valueToAttribute(a.Value)
+			if err != nil {
+				return err
+			}
+			item[a.Key] = av
+			names = append(names, a.Key)
+		}
+		key = keyIdentity(item, names)
+		return nil
+	})
+	return key, err
+}
+
+// attributeToValue converts an attribute to the value it would be parsed
+// from, as far as checking it against a key needs.
+func attributeToValue(av *dynamodb.AttributeValue) *value {
+	switch {
+	case av.S != nil:
+		return &value{String: av.S}
+	case av.N != nil:
+		n := number(*av.N)
+		return &value{Number: &n}
+	case av.B != nil:
+		b := binary(av.B)
+		return &value{Binary: &b}
+	case av.BOOL != nil:
+		b := boolean(*av.BOOL)
+		return &value{literal: literal{Bool: &b}}
+	case av.SS != nil || av.NS != nil || av.BS != nil:
+		return &value{Set: []*value{}}
+	case av.L != nil:
+		return &value{List: []*value{}}
+	case av.M != nil:
+		return &value{literal: literal{Object: &object{}}}
+	}
+	return &value{literal: literal{Null: &null{}}}
+}
+
+// check runs a check against the schema of a table. A schema from the cache
+// is described again if the check fails, in case the table has changed.
+func (c *schemaCache) check(table string, check func(*tableSchema) error) error {
+	schema, cached, err := c.schema(table, false)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "AccessDeniedException" {
+		// The request can still be checked by DynamoDB.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = check(schema)
+	if err != nil && cached {
+		if schema, _, err = c.schema(table, true); err != nil {
+			return err
+		}
+		err = check(schema)
+	}
+	return err
+}
+
+func matchKey(table string, keys []exportKey, attributes []*attribute, item bool) error {
+	values := map[string]*value{}
+	for _, attribute := range attributes {
+		values[attribute.Key] = attribute.Value
+	}
+	for _, key := range keys {
+		v, ok := values[key.AttributeName]
+		if !ok {
+			return validationErrorf("Missing the %s %s, the key of %s is %s", keyRole(key), describeKey(key), table, describeKeys(keys))
+		}
+		if err := coerceKey(key, v); err != nil {
+			return keyTypeError(key, table, v, err)
+		}
+	}
+	if item {
+		return nil
+	}
+	for _, attribute := range attributes {
+		if !isKey(keys, attribute.Key) {
+			return validationErrorf("%s is not part of the key of %s, which is %s", attribute.Key, table, describeKeys(keys))
+		}
+	}
+	return nil
+}
+
+// matchKeyCondition checks that a query's key condition uses the partition
+// key, and optionally the sort key, of a table or index.
+func matchKeyCondition(target string, keys []exportKey, condition *keyCondition) error {
+	partition, sort := keyOfType(keys, dynamodb.KeyTypeHash), keyOfType(keys, dynamodb.KeyTypeRange)
+	if partition == nil {
+		return nil
+	}
+	if condition.Partition.Key != partition.AttributeName {
+		return validationErrorf("%s is not the partition key of %s, the key is %s", condition.Partition.Key, target, describeKeys(keys))
+	}
+	if err := coerceKey(*partition, condition.Partition.Value); err != nil {
+		return keyTypeError(*partition, target, condition.Partition.Value, err)
+	}
+	if condition.Sort == nil {
+		return nil
+	}
+	if sort == nil {
+		return validationErrorf("Can't use a sort key condition with %s, which only has the partition key %s", target, describeKey(*partition))
+	}
+	name, values := condition.Sort.Key, append(condition.Sort.Between, condition.Sort.Value)
+	if condition.Sort.BeginsWith != nil {
+		name, values = condition.Sort.BeginsWith.Key, []*value{condition.Sort.BeginsWith.Prefix}
+		if sort.AttributeType == dynamodb.ScalarAttributeTypeN {
+			return validationErrorf("begins_with can't be used with the number sort key %s of %s", sort.AttributeName, target)
+		}
+	}
+	if name != sort.AttributeName {
+		return validationErrorf("%s is not the sort key of %s, the key is %s", name, target, describeKeys(keys))
+	}
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if err := coerceKey(*sort, v); err != nil {
+			return keyTypeError(*sort, target, v, err)
+		}
+	}
+	return nil
+}
+
+// matchProjection checks that a projection on a global secondary index only
+// reads attributes projected into the index, as they can't be read from the
+// table. Local secondary indexes read them from the table instead.
+func matchProjection(schema *tableSchema, name string, index *indexSchema, projection *projection) error {
+	if !index.Global || index.Projection == dynamodb.ProjectionTypeAll {
+		return nil
+	}
+	projected := map[string]bool{}
+	for _, key := range append(index.KeySchema, schema.KeySchema...) {
+		projected[key.AttributeName] = true
+	}
+	for _, attribute := range index.NonKeyAttributes {
+		projected[attribute] = true
+	}
+	var missing, names []string
+	for _, path := range projection.Paths {
+		if !projected[path.Name] {
+			missing = append(missing, path.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	for attribute := range projected {
+		names = append(names, attribute)
+	}
+	sort.Strings(names)
+	return validationErrorf("Can't project %s from the index %s, which only has the attributes %s (%s). Read them from the table instead", strings.Join(missing, ", "), name, strings.Join(names, ", "), index.Projection)
+}
+
+func keyOfType(keys []exportKey, keyType string) *exportKey {
+	for i := range keys {
+		if keys[i].KeyType == keyType {
+			return &keys[i]
+		}
+	}
+	return nil
+}
+
+func keyTypeError(key exportKey, target string, v *value, err error) error {
+	return validationErrorf("%s must be %s to match the key of %s, got %s", key.AttributeName, err, target, valueKind(v))
+}
+
+// coerceKey converts a value to the type of a key if the conversion is
+// obvious, or returns the type that was needed.
+func coerceKey(key exportKey, v *value) error {
+	if v.Cast != nil && string(v.Cast.Type) == key.AttributeType {
+		return nil
+	}
+	if v.Function != nil && v.Function.attributeType() == key.AttributeType {
+		return nil
+	}
+	switch key.AttributeType {
+	case dynamodb.ScalarAttributeTypeS:
+		if v.Number != nil {
+			s := string(*v.Number)
+			*v = value{String: &s}
+		}
+		if v.String != nil {
+			return nil
+		}
+		return fmt.Errorf("a string (S)")
+	case dynamodb.ScalarAttributeTypeN:
+		if v.String != nil && decimalNumber.MatchString(*v.String) {
+			n := number(*v.String)
+			*v = value{Number: &n}
+		}
+		if v.Number != nil {
+			return nil
+		}
+		return fmt.Errorf("a number (N)")
+	case dynamodb.ScalarAttributeTypeB:
+		if v.binaryValue() != nil {
+			return nil
+		}
+		return fmt.Errorf("binary (B)")
+	}
+	return nil
+}
+
+func isKey(keys []exportKey, name string) bool {
+	for _, key := range keys {
+		if key.AttributeName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func keyRole(key exportKey) string {
+	if key.KeyType == dynamodb.KeyTypeRange {
+		return "sort key"
+	}
+	return "partition key"
+}
+
+func describeKey(key exportKey) string {
+	return fmt.Sprintf("%s (%s)", key.AttributeName, key.AttributeType)
+}
+
+func describeKeys(keys []exportKey) string {
+	var described []string
+	for _, key := range keys {
+		described = append(described, describeKey(key))
+	}
+	return strings.Join(described, " and ")
+}
+
+// valueKind describes the type of a value that was written in a statement.
+func valueKind(v *value) string {
+	switch {
+	case v.Number != nil:
+		return "a number"
+	case v.Bool != nil:
+		return "a boolean"
+	case v.Null != nil:
+		return "null"
+	case v.Cast != nil:
+		return "a value cast to " + string(v.Cast.Type)
+	case v.Function != nil:
+		return fmt.Sprintf("%s(), which returns %s", v.Function.name(), v.Function.attributeType())
+	case v.Set != nil:
+		return "a set"
+	case v.List != nil:
+		return "a list"
+	case v.Map != nil || v.Object != nil:
+		return "a map"
+	case v.binaryValue() != nil:
+		return "binary"
+	case v.String != nil:
+		return "a string"
+	}
+	return "an unknown value"
+}
+
+// checkRead checks that the index being read exists, that a query's key
+// condition uses its keys, and that a projection only asks for attributes in
+// the index.
+func (c *schemaCache) checkRead(table, indexName string, condition *keyCondition, projection *projection) error {
+	return c.check(table, func(schema *tableSchema) error {
+		target, keys := table, schema.KeySchema
+		var index *indexSchema
+		if indexName != "" {
+			if index = schema.Indexes[indexName]; index == nil {
+				return validationErrorf("%s has no index %s%s", table, indexName, describeIndexes(schema))
+			}
+			target, keys = "the index "+indexName, index.KeySchema
+		}
+		if condition != nil {
+			if err := matchKeyCondition(target, keys, condition); err != nil {
+				return err
+			}
+		}
+		if index != nil && projection != nil {
+			return matchProjection(schema, indexName, index, projection)
+		}
+		return nil
+	})
+}
+
+func describeIndexes(schema *tableSchema) string {
+	if len(schema.Indexes) == 0 {
+		return ", it has no indexes"
+	}
+	var names []string
+	for name := range schema.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return ", its indexes are " + strings.Join(names, ", ")
+}
+
+// checkKeys checks every key or item a command will write or read, and the
+// index a query or scan reads, if a schema cache has been set up.
+func checkKeys(args ddbArgs) error {
+	if args.Schemas == nil {
+		return nil
+	}
+	switch args.Command {
+	case "get", "delete":
+		return args.Schemas.checkKey(args.Table, args.Arguments.Attributes, false)
+	case "set":
+		return args.Schemas.checkKey(args.Table, args.Arguments.Attributes, true)
+	case "update":
+		return args.Schemas.checkKey(args.Table, args.Update.Key.Attributes, false)
+	case "query":
+		return args.Schemas.checkRead(args.Table, args.Index, args.KeyCondition, args.Projection)
+	case "scan":
+		if args.Index != "" {
+			return args.Schemas.checkRead(args.Table, args.Index, nil, args.Projection)
+		}
+	case "batch-get":
+		for _, key := range args.Keys {
+			if err := args.Schemas.checkKey(args.Table, key.Attributes, false); err != nil {
+				return err
+			}
+		}
+	case "transact":
+		for _, o := range args.Operations {
+			var err error
+			switch {
+			case o.Update != nil:
+				err = args.Schemas.checkKey(o.Table, o.Update.Update.Key.Attributes, false)
+			default:
+				err = args.Schemas.checkKey(o.Table, o.Write.Item.Attributes, o.Operation == "put")
+			}
+			if _, ok := err.(*validationError); ok {
+				return validationErrorf("%s: %s", o, err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func schemaSetup(t *testing.T, command, table, statement string) (*mockDynamo, error) {
+	client := &mockDynamo{}
+	args := ddbArgs{
+		Client:    client,
+		Command:   command,
+		Table:     table,
+		Format:    "json",
+		Arguments: &keyValue{},
+		Schemas:   newSchemaCache(client, ""),
+	}
+	if err := parseStatement(statement, args.Arguments); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	_, err := run(args)
+	return client, err
+}
+
+func TestCheckKeyCoercesTypes(t *testing.T) {
+	client, err := schemaSetup(t, "get", "authors", `author=1984,published="1949"`)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	key := client.getInput.Key
+	if key["author"].S == nil || *key["author"].S != "1984" {
+		t.Errorf("Expected the number to be sent as a string, got %s", key["author"])
+	}
+	if key["published"].N == nil || *key["published"].N != "1949" {
+		t.Errorf("Expected the string to be sent as a number, got %s", key["published"])
+	}
+}
+
+func TestCheckKeyErrors(t *testing.T) {
+	errors := map[string]string{
+		`author="George Orwell"`:                      "Missing the sort key published (N), the key of authors is author (S) and published (N)",
+		`published=1949`:                              "Missing the partition key author (S), the key of authors is author (S) and published (N)",
+		`author="George Orwell",published="soon"`:     "published must be a number (N) to match the key of authors, got a string",
+		`author=true,published=1949`:                  "author must be a string (S) to match the key of authors, got a boolean",
+		`author="George Orwell",published=S(1949)`:    "published must be a number (N) to match the key of authors, got a value cast to S",
+		`author="George Orwell",published=uuid()`:     "published must be a number (N) to match the key of authors, got uuid(), which returns S",
+		`author="George Orwell",published=1949,x="y"`: "x is not part of the key of authors, which is author (S) and published (N)",
+	}
+	for statement, expected := range errors {
+		client, err := schemaSetup(t, "delete", "authors", statement)
+		if _, ok := err.(*validationError); !ok || err.Error() != expected {
+			t.Errorf("Expected %s to fail with %s, got %v", statement, expected, err)
+		}
+		if client.deleteInput != nil {
+			t.Errorf("Expected nothing to be deleted, got %s", client.deleteInput)
+		}
+	}
+}
+
+func TestCheckKeyAllowsItems(t *testing.T) {
+	client, err := schemaSetup(t, "set", "authors", `author="George Orwell",published=1949,title="1984"`)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if len(client.putInput.Item) != 3 {
+		t.Errorf("Expected the whole item to be put, got %s", client.putInput)
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &mockDynamo{}
+	if err := newSchemaCache(client, dir).checkKey("authors", []*attribute{}, true); err == nil {
+		t.Errorf("Expected the key to be missing")
+	}
+	if client.describes != 1 {
+		t.Fatalf("Expected the table to be described, got %d calls", client.describes)
+	}
+	key := &keyValue{}
+	parseStatement(`author="George Orwell",published=1949`, key)
+	if err := newSchemaCache(client, dir).checkKey("authors", key.Attributes, false); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if client.describes != 1 {
+		t.Errorf("Expected the schema to be read from the cache, got %d calls", client.describes)
+	}
+
+	// A table that was recreated with another key is described again.
+	stale := []byte(`{"keySchema":[{"attributeName":"author","keyType":"HASH","attributeType":"S"}]}`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "authors.json"), stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newSchemaCache(client, dir).checkKey("authors", key.Attributes, false); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if client.describes != 2 {
+		t.Errorf("Expected a stale schema to be described again, got %d calls", client.describes)
+	}
+}
+
+func indexSetup(t *testing.T, command, index, statement, project string) (*mockDynamo, error) {
+	client := &mockDynamo{}
+	args := ddbArgs{
+		Client:  client,
+		Command: command,
+		Table:   "authors",
+		Index:   index,
+		Format:  "json",
+		Output:  &bytes.Buffer{},
+		Schemas: newSchemaCache(client, ""),
+	}
+	if statement != "" {
+		args.KeyCondition = &keyCondition{}
+		if err := parseStatement(statement, args.KeyCondition); err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+	}
+	if project != "" {
+		args.Projection = &projection{}
+		if err := parseStatement(project, args.Projection); err != nil {
+			t.Fatalf("Expected no error, but got %s", err)
+		}
+	}
+	_, err := run(args)
+	return client, err
+}
+
+func TestQueryIndex(t *testing.T) {
+	client, err := indexSetup(t, "query", "by-title", `title=1984`, "title, author")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	input := client.queryInput
+	if *input.IndexName != "by-title" || *input.ExpressionAttributeValues[":v0"].S != "1984" {
+		t.Errorf("Expected a query of the index with a string key, got %s", input)
+	}
+
+	client, err = indexSetup(t, "query", "by-rating", `author="George Orwell", rating between "3" and 5`, "title")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if client.queryInput.ExpressionAttributeValues[":v1"].N == nil {
+		t.Errorf("Expected the sort key to be a number, got %s", client.queryInput)
+	}
+}
+
+func TestScanIndex(t *testing.T) {
+	client, err := indexSetup(t, "scan", "by-title", "", "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.scanInputs[0].IndexName != "by-title" {
+		t.Errorf("Expected a scan of the index, got %s", client.scanInputs[0])
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	tests := []struct {
+		command, index, statement, project, expected string
+	}{
+		{"query", "by-author", `author="George Orwell"`, "", "authors has no index by-author, its indexes are by-rating, by-title"},
+		{"scan", "by-author", "", "", "authors has no index by-author, its indexes are by-rating, by-title"},
+		{"query", "by-title", `author="George Orwell"`, "", "author is not the partition key of the index by-title, the key is title (S)"},
+		{"query", "by-title", `title="1984", published > 1940`, "", "Can't use a sort key condition with the index by-title, which only has the partition key title (S)"},
+		{"query", "", `author="George Orwell", rating > 3`, "", "rating is not the sort key of authors, the key is author (S) and published (N)"},
+		{"query", "", `author="George Orwell", begins_with(published, "19")`, "", "begins_with can't be used with the number sort key published of authors"},
+		{"query", "", `author=[1]`, "", "author must be a string (S) to match the key of authors, got a list"},
+		{"query", "by-title", `title="1984"`, "title, rating, price", "Can't project rating, price from the index by-title, which only has the attributes author, published, title (KEYS_ONLY). Read them from the table instead"},
+		{"scan", "by-title", "", "isbn", "Can't project isbn from the index by-title, which only has the attributes author, published, title (KEYS_ONLY). Read them from the table instead"},
+	}
+	for _, test := range tests {
+		client, err := indexSetup(t, test.command, test.index, test.statement, test.project)
+		if _, ok := err.(*validationError); !ok || err.Error() != test.expected {
+			t.Errorf("Expected %s %s to fail with %s, got %v", test.command, test.statement, test.expected, err)
+		}
+		if client.queryInput != nil || len(client.scanInputs) > 0 {
+			t.Errorf("Expected nothing to be read")
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/peterh/liner"
+)
+
+const shellHelp = `Commands:
+  use <table>                    Use a table for the following commands
+  get <key=value,...>            Get an item
+  set <key=value,...> [if ...]   Put an item, optionally only if a condition holds
+  delete <key=value,...> [if ...]
+  update key <key=value,...> set|remove|add|delete ... [if ...]
+  scan [filter]                  Scan the table, optionally keeping items that match a filter
+  query <key=value>[, <sort key condition>]
+  help                           Show this help
+  exit                           Leave the shell
+Press tab to complete commands, table names and attribute names.`
+
+var shellCommands = []string{"use", "get", "set", "delete", "update", "scan", "query", "help", "exit"}
+
+// shell keeps a session with a table, so that statements can be typed
+// without escaping them from a shell. Attribute names are learned from the
+// table's key schema and from the items that are read, for tab completion.
+type shell struct {
+	args   ddbArgs
+	tables []string
+	// mutex guards attributes, which segments of a scan learn concurrently.
+	mutex      sync.Mutex
+	attributes map[string]map[string]bool
+}
+
+func newShell(args ddbArgs) *shell {
+	s := &shell{attributes: map[string]map[string]bool{}}
+	args.Client = &learningClient{DynamoDBAPI: args.Client, shell: s}
+	s.args = args
+	return s
+}
+
+// runShell reads commands until the user exits, keeping history in
+// ~/.ddb_history between sessions.
+func runShell(args ddbArgs) error {
+	reserveStdin("shell commands")
+	s := newShell(args)
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetWordCompleter(s.complete)
+
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".ddb_history")
+		if f, err := os.Open(historyFile); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+	}
+	if s.args.Table != "" {
+		s.use(s.args.Table)
+	}
+
+	for {
+		input, err := line.Prompt(s.prompt())
+		if err == liner.ErrPromptAborted {
+			continue
+		}
+		if err == io.EOF {
+			fmt.Fprintln(s.args.Output)
+			break
+		}
+		if err != nil {
+			return err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+		if input == "exit" || input == "quit" {
+			break
+		}
+		if err := s.execute(input); err != nil {
+			fmt.Fprintf(s.args.Progress, "Error: %s\n", err)
+		}
+	}
+
+	if historyFile != "" {
+		if f, err := os.Create(historyFile); err == nil {
+			line.WriteHistory(f)
+			f.Close()
+		}
+	}
+	return nil
+}
+
+func (s *shell) prompt() string {
+	if s.args.Table == "" {
+		return "ddb> "
+	}
+	return "ddb:" + s.args.Table + "> "
+}
+
+// execute runs a single line, printing any result.
+func (s *shell) execute(line string) error {
+	command, statement := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		command, statement = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	command = strings.ToLower(command)
+	switch command {
+	case "help":
+		fmt.Fprintln(s.args.Output, shellHelp)
+		return nil
+	case "use":
+		if statement == "" {
+			return errors.New("Expected a table name, such as: use books")
+		}
+		return s.use(statement)
+	case "get", "set", "delete", "update", "scan", "query":
+	default:
+		return fmt.Errorf("Unknown command %s, type help for a list of commands", command)
+	}
+	if s.args.Table == "" {
+		return errors.New("No table selected, type use <table> first")
+	}
+	if statement == "" && command != "scan" {
+		return fmt.Errorf("Expected a statement after %s", command)
+	}
+
+	args := s.args
+	args.Command = command
+	switch command {
+	case "get":
+		args.Arguments = &keyValue{}
+		if err := parseStatement(statement, args.Arguments); err != nil {
+			return err
+		}
+		if len(args.Arguments.Attributes) > 2 {
+			return validationErrorf("Expected one or two key=value pair(s) for a get request")
+		}
+	case "set", "delete":
+		write := &transactWrite{}
+		if err := parseStatement(statement, write); err != nil {
+			return err
+		}
+		if command == "delete" && len(write.Item.Attributes) > 2 {
+			return validationErrorf("Expected one or two key=value pair(s) for a delete request")
+		}
+		args.Arguments = write.Item
+		args.Condition = write.Condition
+	case "update":
+		update := &transactUpdate{}
+		if err := parseStatement(statement, update); err != nil {
+			return err
+		}
+		args.Update = update.Update
+		args.Condition = update.Condition
+		args.ReturnValues = "ALL_NEW"
+	case "scan":
+		if statement != "" {
+			args.Filter = &condition{}
+			if err := parseStatement(statement, args.Filter); err != nil {
+				return err
+			}
+		}
+	case "query":
+		args.KeyCondition = &keyCondition{}
+		if err := parseStatement(statement, args.KeyCondition); err != nil {
+			return err
+		}
+	}
+
+	result, err := run(args)
+	if err != nil {
+		return newServiceError(err)
+	}
+	if result != "" {
+		fmt.Fprintln(s.args.Output, result)
+	}
+	return nil
+}
+
+// use switches to a table, learning its key attributes.
+func (s *shell) use(table string) error {
+	resp, err := s.args.Client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return newServiceError(err)
+	}
+	s.args.Table = table
+	for _, key := range resp.Table.KeySchema {
+		s.learn(table, aws.StringValue(key.AttributeName))
+	}
+	for _, index := range resp.Table.GlobalSecondaryIndexes {
+		for _, key := range index.KeySchema {
+			s.learn(table, aws.StringValue(key.AttributeName))
+		}
+	}
+	return nil
+}
+
+func (s *shell) learn(table string, names ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.attributes[table] == nil {
+		s.attributes[table] = map[string]bool{}
+	}
+	for _, name := range names {
+		s.attributes[table][name] = true
+	}
+}
+
+// complete completes the word before the cursor: a command at the start of
+// the line, a table name after use, and otherwise an attribute name.
+func (s *shell) complete(line string, pos int) (head string, completions []string, tail string) {
+	head, tail = line[:pos], line[pos:]
+	start := strings.LastIndexFunc(head, func(r rune) bool {
+		return !(r == '_' || r == '-' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) + 1
+	word := head[start:]
+	head = head[:start]
+
+	var candidates []string
+	switch {
+	case strings.TrimSpace(head) == "":
+		candidates = shellCommands
+	case strings.ToLower(strings.TrimSpace(head)) == "use":
+		candidates = s.tableNames()
+	default:
+		s.mutex.Lock()
+		for name := range s.attributes[s.args.Table] {
+			candidates = append(candidates, name)
+		}
+		s.mutex.Unlock()
+		sort.Strings(candidates)
+	}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			completions = append(completions, candidate)
+		}
+	}
+	return head, completions, tail
+}
+
+// tableNames lists the tables once per session.
+func (s *shell) tableNames() []string {
+	if s.tables != nil {
+		return s.tables
+	}
+	s.tables = []string{}
+	s.args.Client.ListTablesPages(&dynamodb.ListTablesInput{}, func(page *dynamodb.ListTablesOutput, lastPage bool) bool {
+		s.tables = append(s.tables, aws.StringValueSlice(page.TableNames)...)
+		return true
+	})
+	return s.tables
+}
+
+// learningClient records the attribute names of every item read in the
+// shell, so they can be tab completed.
+type learningClient struct {
+	dynamodbiface.DynamoDBAPI
+	shell *shell
+}
+
+func (c *learningClient) learnItems(table *string, items ...map[string]*dynamodb.AttributeValue) {
+	for _, item := range items {
+		for name := range item {
+			c.shell.learn(aws.StringValue(table), name)
+		}
+	}
+}
+
+func (c *learningClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	resp, err := c.DynamoDBAPI.GetItem(input)
+	if err == nil {
+		c.learnItems(input.TableName, resp.Item)
+	}
+	return resp, err
+}
+
+func (c *learningClient) ScanPages(input *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool) error {
+	return c.DynamoDBAPI.ScanPages(input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		c.learnItems(input.TableName, page.Items...)
+		return fn(page, lastPage)
+	})
+}
+
+func (c *learningClient) QueryPages(input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+	return c.DynamoDBAPI.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		c.learnItems(input.TableName, page.Items...)
+		return fn(page, lastPage)
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func (d *mockDynamo) ListTablesPages(input *dynamodb.ListTablesInput, fn func(*dynamodb.ListTablesOutput, bool) bool) error {
+	if fn(&dynamodb.ListTablesOutput{TableNames: []*string{aws.String("books"), aws.String("authors")}}, false) {
+		fn(&dynamodb.ListTablesOutput{TableNames: []*string{aws.String("bookshelves")}}, true)
+	}
+	return nil
+}
+
+func shellSetup() (*shell, *mockDynamo, *bytes.Buffer) {
+	client := &mockDynamo{}
+	output := &bytes.Buffer{}
+	s := newShell(ddbArgs{
+		Client: client,
+		Output: output,
+		Format: "json",
+	})
+	return s, client, output
+}
+
+func TestShellGet(t *testing.T) {
+	s, client, output := shellSetup()
+	if err := s.execute("get string=bar"); err == nil || err.Error() != "No table selected, type use <table> first" {
+		t.Errorf("Expected an error without a table, got %v", err)
+	}
+	if err := s.execute("use books"); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if s.prompt() != "ddb:books> " {
+		t.Errorf("Expected the prompt to show the table, got %s", s.prompt())
+	}
+	if err := s.execute(`GET string="bar"`); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.getInput.TableName != "books" || *client.getInput.Key["string"].S != "bar" {
+		t.Errorf("Expected a get from books, got %s", client.getInput)
+	}
+	expected := `{"number":123.4,"string":"bar"}` + "\n"
+	if output.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, output)
+	}
+}
+
+func TestShellSetWithCondition(t *testing.T) {
+	s, client, _ := shellSetup()
+	s.execute("use books")
+	if err := s.execute(`set book="1984",copies=3 if attribute_not_exists(book)`); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.putInput.Item["copies"].N != "3" || *client.putInput.ConditionExpression != "attribute_not_exists(#n0)" {
+		t.Errorf("Expected a conditional put, got %s", client.putInput)
+	}
+}
+
+func TestShellScanFilter(t *testing.T) {
+	s, client, _ := shellSetup()
+	s.execute("use books")
+	if err := s.execute(`scan string = "foo"`); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.scanInputs[0].FilterExpression != "#n0 = :v0" {
+		t.Errorf("Expected a filter, got %s", client.scanInputs[0])
+	}
+}
+
+func TestShellScanSegments(t *testing.T) {
+	s, _, _ := shellSetup()
+	s.args.Segments = 2
+	s.execute("use books")
+	if err := s.execute("scan"); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if !s.attributes["books"]["string"] {
+		t.Errorf("Expected attributes to be learned from every segment, got %v", s.attributes)
+	}
+}
+
+func TestShellErrors(t *testing.T) {
+	s, _, _ := shellSetup()
+	s.execute("use books")
+	errors := map[string]string{
+		"select *":                "Unknown command select, type help for a list of commands",
+		"query":                   "Expected a statement after query",
+		"use":                     "Expected a table name, such as: use books",
+		"get a=1,b=2,c=3":         "Expected one or two key=value pair(s) for a get request",
+		`set a=("x", 1)`:          "a: Invalid values found in Set. Must be all strings, all numbers or all binary",
+		`delete a=1,b=2,c=3 if a`: "",
+	}
+	for line, expected := range errors {
+		err := s.execute(line)
+		if err == nil || (expected != "" && err.Error() != expected) {
+			t.Errorf("Expected %s to fail with %s, got %v", line, expected, err)
+		}
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	s, _, _ := shellSetup()
+	s.execute("use books")
+	s.execute(`get string="bar"`)
+
+	completions := map[string][]string{
+		"":                   shellCommands,
+		"sc":                 {"scan"},
+		"use bo":             {"books", "bookshelves"},
+		`get str`:            {"string"},
+		`query string="x", `: {"number", "string"},
+	}
+	for line, expected := range completions {
+		_, got, _ := s.complete(line, len(line))
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %q to complete to %v, got %v", line, expected, got)
+		}
+	}
+
+	head, _, tail := s.complete("get str = 1", 7)
+	if head != "get " || tail != " = 1" {
+		t.Errorf("Expected the word before the cursor to be completed, got %q and %q", head, tail)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const tablesUsage = `Usage: ddb tables list
+       ddb tables describe <table-name>
+       ddb tables create <table-name> -key <name:type[,name:type]> [-gsi <index-name=name:type[,name:type]>] [-billing on-demand|provisioned]
+       ddb tables delete <table-name> [-yes]`
+
+type tablesArgs struct {
+	Client   dynamodbiface.DynamoDBAPI
+	Action   string
+	Table    string
+	Key      []exportKey
+	Indexes  map[string][]exportKey
+	Billing  string
+	Read     int64
+	Write    int64
+	Yes      bool
+	Format   string
+	Output   io.Writer
+	Progress io.Writer
+	Input    io.Reader
+	Schemas  *schemaCache
+}
+
+// runTables parses the arguments after ddb tables and runs the action. Flags
+// may come before or after the action and table name.
+func runTables(arguments []string) error {
+	flags := flag.NewFlagSet("ddb tables", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	endpoint := flags.String("endpoint", "", "Endpoint URL for DynamoDB. Useful for testing with local DynamoDB")
+	output := flags.String("output", "table", "The output format: table or json")
+	key := flags.String("key", "", "The partition key, and optionally the sort key, of a new table, such as 'author:S,published:N'")
+	var indexes statementList
+	flags.Var(&indexes, "gsi", "A global secondary index of a new table, such as 'by-title=title:S'. Repeat it to create several indexes")
+	billing := flags.String("billing", "on-demand", "The billing mode of a new table: on-demand or provisioned")
+	read := flags.Int64("read", 5, "The read capacity units of a new provisioned table")
+	write := flags.Int64("write", 5, "The write capacity units of a new provisioned table")
+	yes := flags.Bool("yes", false, "Delete a table without asking for confirmation")
+
+	var positional []string
+	for {
+		if err := flags.Parse(arguments); err != nil {
+			return usageErrorf("%s\n%s", err, tablesUsage)
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		arguments = flags.Args()[1:]
+	}
+
+	args := tablesArgs{
+		Billing:  *billing,
+		Read:     *read,
+		Write:    *write,
+		Yes:      *yes,
+		Format:   *output,
+		Output:   os.Stdout,
+		Progress: os.Stderr,
+		Input:    os.Stdin,
+	}
+	if len(positional) > 0 {
+		args.Action = positional[0]
+	}
+	switch {
+	case args.Action == "list" && len(positional) == 1:
+	case (args.Action == "describe" || args.Action == "create" || args.Action == "delete") && len(positional) == 2:
+		args.Table = positional[1]
+	default:
+		return &usageError{tablesUsage}
+	}
+	if args.Format != "table" && args.Format != "json" {
+		return usageErrorf("Expected -output to be table or json")
+	}
+	if args.Action == "create" {
+		if *key == "" {
+			return usageErrorf("Expected a -key for the new table, such as -key 'author:S,published:N'")
+		}
+		if args.Billing != "on-demand" && args.Billing != "provisioned" {
+			return usageErrorf("Expected -billing to be on-demand or provisioned")
+		}
+		var err error
+		if args.Key, err = parseKeySpec(*key); err != nil {
+			return err
+		}
+		args.Indexes = map[string][]exportKey{}
+		for _, index := range indexes {
+			parts := strings.SplitN(index, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return validationErrorf("Expected -gsi to be an index name and key, such as 'by-title=title:S', got %s", index)
+			}
+			if args.Indexes[parts[0]], err = parseKeySpec(parts[1]); err != nil {
+				return err
+			}
+		}
+	} else if *key != "" || len(indexes) > 0 {
+		return usageErrorf("-key and -gsi can only be used with create")
+	}
+
+	sess := newSession(*endpoint)
+	args.Client = dynamodb.New(sess)
+	args.Schemas = newSchemaCache(args.Client, schemaCacheDir(*endpoint, aws.StringValue(sess.Config.Region)))
+	if err := tables(args); err != nil {
+		return newServiceError(err)
+	}
+	return nil
+}
+
+// parseKeySpec parses a partition key and optional sort key, such as
+// 'author:S,published:N'.
+func parseKeySpec(spec string) ([]exportKey, error) {
+	var keys []exportKey
+	for i, part := range strings.Split(spec, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, validationErrorf("Expected a key to be name:type, such as author:S, got %s", part)
+		}
+		attributeType := strings.ToUpper(fields[1])
+		if attributeType != "S" && attributeType != "N" && attributeType != "B" {
+			return nil, validationErrorf("Expected the type of %s to be S, N or B, got %s", fields[0], fields[1])
+		}
+		keyType := dynamodb.KeyTypeHash
+		if i > 0 {
+			keyType = dynamodb.KeyTypeRange
+		}
+		keys = append(keys, exportKey{AttributeName: fields[0], KeyType: keyType, AttributeType: attributeType})
+	}
+	if len(keys) > 2 {
+		return nil, validationErrorf("Expected a partition key and at most one sort key, got %s", spec)
+	}
+	return keys, nil
+}
+
+func tables(args tablesArgs) error {
+	switch args.Action {
+	case "list":
+		return listTables(args)
+	case "describe":
+		return describeTable(args)
+	case "create":
+		return createTable(args)
+	}
+	return deleteTable(args)
+}
+
+func listTables(args tablesArgs) error {
+	names := []string{}
+	err := args.Client.ListTablesPages(&dynamodb.ListTablesInput{}, func(page *dynamodb.ListTablesOutput, lastPage bool) bool {
+		names = append(names, aws.StringValueSlice(page.TableNames)...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if args.Format == "json" {
+		return json.NewEncoder(args.Output).Encode(names)
+	}
+	for _, name := range names {
+		fmt.Fprintln(args.Output, name)
+	}
+	return nil
+}
+
+func describeTable(args tablesArgs) error {
+	resp, err := args.Client.DescribeTable(&dynamodb.DescribeTableInput{
+		TableName: aws.String(args.Table),
+	})
+	if err != nil {
+		return err
+	}
+	return writeTable(args, resp.Table)
+}
+
+// writeTable writes a table description as JSON, or as a summary of the
+// table followed by its indexes.
+func writeTable(args tablesArgs, table *dynamodb.TableDescription) error {
+	if args.Format == "json" {
+		encoder := json.NewEncoder(args.Output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(table)
+	}
+
+	w := tabwriter.NewWriter(args.Output, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Table:\t%s\n", aws.StringValue(table.TableName))
+	fmt.Fprintf(w, "Status:\t%s\n", aws.StringValue(table.TableStatus))
+	fmt.Fprintf(w, "Key:\t%s\n", describeKeys(keySchema(table)))
+	if table.BillingModeSummary != nil && aws.StringValue(table.BillingModeSummary.BillingMode) == dynamodb.BillingModePayPerRequest {
+		fmt.Fprintf(w, "Billing:\ton-demand\n")
+	} else if table.ProvisionedThroughput != nil {
+		fmt.Fprintf(w, "Billing:\tprovisioned, %d read and %d write capacity units\n", aws.Int64Value(table.ProvisionedThroughput.ReadCapacityUnits), aws.Int64Value(table.ProvisionedThroughput.WriteCapacityUnits))
+	}
+	fmt.Fprintf(w, "Items:\t%d (%s)\n", aws.Int64Value(table.ItemCount), formatBytes(aws.Int64Value(table.TableSizeBytes)))
+	if table.CreationDateTime != nil {
+		fmt.Fprintf(w, "Created:\t%s\n", table.CreationDateTime.Format(time.RFC3339))
+	}
+
+	if len(table.GlobalSecondaryIndexes) > 0 || len(table.LocalSecondaryIndexes) > 0 {
+		fmt.Fprintf(w, "\nIndex\tType\tKey\tStatus\n")
+		for _, index := range table.GlobalSecondaryIndexes {
+			fmt.Fprintf(w, "%s\tglobal\t%s\t%s\n", aws.StringValue(index.IndexName), describeKeys(keyElements(table, index.KeySchema)), aws.StringValue(index.IndexStatus))
+		}
+		for _, index := range table.LocalSecondaryIndexes {
+			fmt.Fprintf(w, "%s\tlocal\t%s\t\n", aws.StringValue(index.IndexName), describeKeys(keyElements(table, index.KeySchema)))
+		}
+	}
+	return w.Flush()
+}
+
+func formatBytes(n int64) string {
+	units := []string{"bytes", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// createTable creates a table and waits until it can be used.
+func createTable(args tablesArgs) error {
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(args.Table),
+		KeySchema: keySchemaElements(args.Key),
+	}
+	if args.Billing == "provisioned" {
+		input.BillingMode = aws.String(dynamodb.BillingModeProvisioned)
+		input.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(args.Read),
+			WriteCapacityUnits: aws.Int64(args.Write),
+		}
+	} else {
+		input.BillingMode = aws.String(dynamodb.BillingModePayPerRequest)
+	}
+
+	// Every attribute used in a key is defined once, with one type.
+	types := map[string]string{}
+	define := func(keys []exportKey) error {
+		for _, key := range keys {
+			if t, ok := types[key.AttributeName]; ok {
+				if t != key.AttributeType {
+					return validationErrorf("%s is used as both %s and %s", key.AttributeName, t, key.AttributeType)
+				}
+				continue
+			}
+			types[key.AttributeName] = key.AttributeType
+			input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+				AttributeName: aws.String(key.AttributeName),
+				AttributeType: aws.String(key.AttributeType),
+			})
+		}
+		return nil
+	}
+	if err := define(args.Key); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(args.Indexes))
+	for name := range args.Indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := define(args.Indexes[name]); err != nil {
+			return err
+		}
+		index := &dynamodb.GlobalSecondaryIndex{
+			IndexName:  aws.String(name),
+			KeySchema:  keySchemaElements(args.Indexes[name]),
+			Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+		}
+		if args.Billing == "provisioned" {
+			index.ProvisionedThroughput = input.ProvisionedThroughput
+		}
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, index)
+	}
+
+	if _, err := args.Client.CreateTable(input); err != nil {
+		return err
+	}
+	args.Schemas.forget(args.Table)
+	fmt.Fprintf(args.Progress, "Waiting for %s to be created\n", args.Table)
+	if err := args.Client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: input.TableName}); err != nil {
+		return err
+	}
+	return describeTable(args)
+}
+
+func keySchemaElements(keys []exportKey) []*dynamodb.KeySchemaElement {
+	var elements []*dynamodb.KeySchemaElement
+	for _, key := range keys {
+		elements = append(elements, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(key.AttributeName),
+			KeyType:       aws.String(key.KeyType),
+		})
+	}
+	return elements
+}
+
+// deleteTable deletes a table once the table name has been typed to confirm
+// it, unless -yes was given, and waits until it is gone.
+func deleteTable(args tablesArgs) error {
+	if !args.Yes {
+		fmt.Fprintf(args.Progress, "Delete %s and every item in it? Type the table name to confirm: ", args.Table)
+		answer, _ := bufio.NewReader(args.Input).ReadString('\n')
+		if strings.TrimSpace(answer) != args.Table {
+			return usageErrorf("%s was not deleted", args.Table)
+		}
+	}
+	resp, err := args.Client.DeleteTable(&dynamodb.DeleteTableInput{
+		TableName: aws.String(args.Table),
+	})
+	if err != nil {
+		return err
+	}
+	args.Schemas.forget(args.Table)
+	fmt.Fprintf(args.Progress, "Waiting for %s to be deleted\n", args.Table)
+	if err := args.Client.WaitUntilTableNotExists(&dynamodb.DescribeTableInput{TableName: aws.String(args.Table)}); err != nil {
+		return err
+	}
+	if args.Format == "json" {
+		return writeTable(args, resp.TableDescription)
+	}
+	fmt.Fprintf(args.Output, "Deleted %s\n", args.Table)
+	return nil
+}
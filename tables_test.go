@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func (d *mockDynamo) CreateTable(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	d.createTable = input
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (d *mockDynamo) DeleteTable(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+	d.deleteTable = input
+	return &dynamodb.DeleteTableOutput{
+		TableDescription: &dynamodb.TableDescription{TableName: input.TableName, TableStatus: aws.String("DELETING")},
+	}, nil
+}
+
+func (d *mockDynamo) WaitUntilTableExists(input *dynamodb.DescribeTableInput) error {
+	return nil
+}
+
+func (d *mockDynamo) WaitUntilTableNotExists(input *dynamodb.DescribeTableInput) error {
+	return nil
+}
+
+func tablesSetup(action, table, format string) (tablesArgs, *mockDynamo, *bytes.Buffer) {
+	client := &mockDynamo{}
+	output := &bytes.Buffer{}
+	return tablesArgs{
+		Client:   client,
+		Action:   action,
+		Table:    table,
+		Format:   format,
+		Output:   output,
+		Progress: &bytes.Buffer{},
+		Input:    strings.NewReader(""),
+		Schemas:  newSchemaCache(client, ""),
+	}, client, output
+}
+
+func TestTablesList(t *testing.T) {
+	args, _, output := tablesSetup("list", "", "table")
+	if err := tables(args); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if output.String() != "books\nauthors\nbookshelves\n" {
+		t.Errorf("Expected a table name on each line, got %s", output)
+	}
+
+	args, _, output = tablesSetup("list", "", "json")
+	tables(args)
+	if output.String() != `["books","authors","bookshelves"]`+"\n" {
+		t.Errorf("Expected a JSON array, got %s", output)
+	}
+}
+
+func TestTablesDescribe(t *testing.T) {
+	args, _, output := tablesSetup("describe", "authors", "table")
+	if err := tables(args); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if !strings.Contains(output.String(), "Key:     author (S) and published (N)\n") {
+		t.Errorf("Expected the key to be described, got %s", output)
+	}
+
+	args, _, output = tablesSetup("describe", "authors", "json")
+	tables(args)
+	var table dynamodb.TableDescription
+	if err := json.Unmarshal(output.Bytes(), &table); err != nil || *table.TableName != "authors" {
+		t.Errorf("Expected the table description as JSON, got %s", output)
+	}
+}
+
+func TestTablesCreate(t *testing.T) {
+	args, client, _ := tablesSetup("create", "authors", "table")
+	var err error
+	if args.Key, err = parseKeySpec("author:S,published:n"); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	index, _ := parseKeySpec("title:S")
+	args.Indexes = map[string][]exportKey{"by-title": index}
+	args.Billing = "on-demand"
+	if err := tables(args); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+
+	input := client.createTable
+	if *input.KeySchema[0].AttributeName != "author" || *input.KeySchema[1].KeyType != "RANGE" {
+		t.Errorf("Expected a partition and sort key, got %s", input.KeySchema)
+	}
+	if len(input.AttributeDefinitions) != 3 || *input.AttributeDefinitions[1].AttributeType != "N" {
+		t.Errorf("Expected every key attribute to be defined, got %s", input.AttributeDefinitions)
+	}
+	if *input.BillingMode != "PAY_PER_REQUEST" || input.ProvisionedThroughput != nil {
+		t.Errorf("Expected an on-demand table, got %s", input)
+	}
+	if len(input.GlobalSecondaryIndexes) != 1 || *input.GlobalSecondaryIndexes[0].IndexName != "by-title" {
+		t.Errorf("Expected a global secondary index, got %s", input.GlobalSecondaryIndexes)
+	}
+}
+
+func TestTablesCreateConflictingTypes(t *testing.T) {
+	args, client, _ := tablesSetup("create", "authors", "table")
+	args.Key, _ = parseKeySpec("author:S")
+	index, _ := parseKeySpec("author:N")
+	args.Indexes = map[string][]exportKey{"by-number": index}
+	err := tables(args)
+	if _, ok := err.(*validationError); !ok || err.Error() != "author is used as both S and N" {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+	if client.createTable != nil {
+		t.Errorf("Expected no table to be created")
+	}
+}
+
+func TestParseKeySpecErrors(t *testing.T) {
+	errors := map[string]string{
+		"author":      "Expected a key to be name:type, such as author:S, got author",
+		"author:X":    "Expected the type of author to be S, N or B, got X",
+		"a:S,b:N,c:S": "Expected a partition key and at most one sort key, got a:S,b:N,c:S",
+		"author:S,:N": "Expected a key to be name:type, such as author:S, got :N",
+	}
+	for spec, expected := range errors {
+		if _, err := parseKeySpec(spec); err == nil || err.Error() != expected {
+			t.Errorf("Expected %s to fail with %s, got %v", spec, expected, err)
+		}
+	}
+}
+
+func TestTablesDeleteConfirmation(t *testing.T) {
+	args, client, _ := tablesSetup("delete", "books", "table")
+	args.Input = strings.NewReader("book\n")
+	if err := tables(args); err == nil || err.Error() != "books was not deleted" {
+		t.Errorf("Expected the table not to be deleted, got %v", err)
+	}
+	if client.deleteTable != nil {
+		t.Fatalf("Expected no table to be deleted")
+	}
+
+	args, client, output := tablesSetup("delete", "books", "table")
+	args.Input = strings.NewReader("books\n")
+	if err := tables(args); err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if *client.deleteTable.TableName != "books" || output.String() != "Deleted books\n" {
+		t.Errorf("Expected the table to be deleted, got %s", output)
+	}
+
+	args, client, _ = tablesSetup("delete", "books", "table")
+	args.Yes = true
+	if err := tables(args); err != nil || client.deleteTable == nil {
+		t.Errorf("Expected -yes to delete without confirmation, got %v", err)
+	}
+}
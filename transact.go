@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/lexer"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// transactWrite is the grammar for put, delete and condition-check lines in a
+// transact script. Each is followed by an optional condition, for example:
+//
+//	put books book="1984",author="George Orwell" if attribute_not_exists(book)
+//	condition-check authors author="George Orwell" if attribute_exists(author)
+type transactWrite struct {
+	Item      *keyValue  `@@`
+	Condition *condition `[ "if" @@ ]`
+}
+
+// transactUpdate is the grammar for update lines, which use the same
+// statement as -command update, for example:
+//
+//	update books key book="1984" set copies=copies-1 if copies > 0
+type transactUpdate struct {
+	Update    *updateStatement `@@`
+	Condition *condition       `[ "if" @@ ]`
+}
+
+// transactOperation is one line of a transact script.
+type transactOperation struct {
+	Line      int
+	Operation string
+	Table     string
+	Write     *transactWrite
+	Update    *transactUpdate
+}
+
+func (o *transactOperation) String() string {
+	return fmt.Sprintf("line %d (%s %s)", o.Line, o.Operation, o.Table)
+}
+
+// readTransactScript parses a script with one operation per line, each naming
+// the operation and table followed by a statement. Blank lines and lines
+// starting with # are skipped.
+func readTransactScript(r io.Reader) ([]*transactOperation, error) {
+	var operations []*transactOperation
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		// Errors are reported against the whole line, so positions within
+		// the statement are moved along by the operation and table.
+		fail := func(column int, message string) error {
+			return &parseError{statement: text, pos: &lexer.Position{Line: line, Column: column}, message: message}
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fail(1, "expected an operation, a table and a statement")
+		}
+		start := skipSpace(text, skipSpace(text, 0)+len(fields[0]))
+		start = skipSpace(text, start+len(fields[1]))
+		statement := strings.TrimSpace(text[start:])
+		operation := &transactOperation{
+			Line:      line,
+			Operation: strings.ToLower(fields[0]),
+			Table:     fields[1],
+		}
+		var err error
+		switch operation.Operation {
+		case "put", "delete", "condition-check":
+			operation.Write = &transactWrite{}
+			err = parseStatement(statement, operation.Write)
+			if err == nil && operation.Operation == "condition-check" && operation.Write.Condition == nil {
+				err = fail(len(strings.TrimRight(text, " \t"))+1, "a condition-check needs an if condition")
+			}
+			if err == nil && operation.Operation != "put" && len(operation.Write.Item.Attributes) > 2 {
+				err = fail(start+1, fmt.Sprintf("expected one or two key=value pair(s) for a %s", operation.Operation))
+			}
+		case "update":
+			operation.Update = &transactUpdate{}
+			err = parseStatement(statement, operation.Update)
+		default:
+			err = fail(skipSpace(text, 0)+1, fmt.Sprintf("unknown operation %s, expected put, update, delete or condition-check", fields[0]))
+		}
+		if perr, ok := err.(*parseError); ok && perr.statement == statement {
+			column := utf8.RuneCountInString(text[:start]) + 1
+			if perr.pos != nil {
+				column += perr.pos.Column - 1
+			}
+			perr.statement, perr.pos = text, &lexer.Position{Line: line, Column: column}
+		}
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, operation)
+	}
+	return operations, scanner.Err()
+}
+
+// skipSpace returns the index of the first character from i that isn't a
+// space or tab.
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// transactItem converts an operation into a TransactWriteItem, with its own
+// placeholders for names and values.
+func (o *transactOperation) transactItem() (*dynamodb.TransactWriteItem, error) {
+	var key map[string]*dynamodb.AttributeValue
+	var err error
+	if o.Write != nil {
+		key, err = buildKey(o.Write.Item.Attributes)
+	} else {
+		key, err = buildKey(o.Update.Update.Key.Attributes)
+	}
+	if err != nil {
+		return nil, validationErrorf("%s: %s", o, err)
+	}
+	builder := newExpressionBuilder()
+	var cond *condition
+	var conditionExpression *string
+	if o.Write != nil {
+		cond = o.Write.Condition
+	} else {
+		cond = o.Update.Condition
+	}
+	var updateExpression string
+	if o.Update != nil {
+		// The update expression is built first so that placeholders are
+		// numbered in the order they appear in the script.
+		updateExpression = o.Update.Update.expression(builder)
+	}
+	if cond != nil {
+		conditionExpression = aws.String(cond.expression(builder))
+	}
+	if builder.err != nil {
+		return nil, validationErrorf("%s: %s", o, builder.err)
+	}
+
+	switch o.Operation {
+	case "put":
+		return &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName:                 aws.String(o.Table),
+			Item:                      key,
+			ConditionExpression:       conditionExpression,
+			ExpressionAttributeNames:  builder.attributeNames(),
+			ExpressionAttributeValues: builder.attributeValues(),
+		}}, nil
+	case "delete":
+		return &dynamodb.TransactWriteItem{Delete: &dynamodb.Delete{
+			TableName:                 aws.String(o.Table),
+			Key:                       key,
+			ConditionExpression:       conditionExpression,
+			ExpressionAttributeNames:  builder.attributeNames(),
+			ExpressionAttributeValues: builder.attributeValues(),
+		}}, nil
+	case "condition-check":
+		return &dynamodb.TransactWriteItem{ConditionCheck: &dynamodb.ConditionCheck{
+			TableName:                 aws.String(o.Table),
+			Key:                       key,
+			ConditionExpression:       conditionExpression,
+			ExpressionAttributeNames:  builder.attributeNames(),
+			ExpressionAttributeValues: builder.attributeValues(),
+		}}, nil
+	}
+	return &dynamodb.TransactWriteItem{Update: &dynamodb.Update{
+		TableName:                 aws.String(o.Table),
+		Key:                       key,
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       conditionExpression,
+		ExpressionAttributeNames:  builder.attributeNames(),
+		ExpressionAttributeValues: builder.attributeValues(),
+	}}, nil
+}
+
+// transact writes every operation in the script in a single transaction.
+func transact(args ddbArgs) (string, error) {
+	input := &dynamodb.TransactWriteItemsInput{}
+	for _, operation := range args.Operations {
+		item, err := operation.transactItem()
+		if err != nil {
+			return "", err
+		}
+		input.TransactItems = append(input.TransactItems, item)
+	}
+	_, err := args.Client.TransactWriteItems(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+		return "", newTransactionCanceledError(aerr, args.Operations)
+	}
+	return "", err
+}
+
+// transactionCanceledError explains which operations caused a transaction to
+// be cancelled.
+type transactionCanceledError struct {
+	err        awserr.Error
+	operations []*transactOperation
+	reasons    []string
+}
+
+// cancellationReasons matches the list of reasons at the end of the
+// TransactionCanceledException message, one for each operation, such as
+// [None, ConditionalCheckFailed]. This version of the SDK doesn't parse them.
+var cancellationReasons = regexp.MustCompile(`\[([A-Za-z, ]*)\]\s*$`)
+
+func newTransactionCanceledError(err awserr.Error, operations []*transactOperation) *transactionCanceledError {
+	e := &transactionCanceledError{err: err, operations: operations}
+	if match := cancellationReasons.FindStringSubmatch(err.Message()); match != nil {
+		for _, reason := range strings.Split(match[1], ",") {
+			e.reasons = append(e.reasons, strings.TrimSpace(reason))
+		}
+	}
+	return e
+}
+
+// conditionFailed reports whether any operation was cancelled because its
+// condition was not met.
+func (e *transactionCanceledError) conditionFailed() bool {
+	for _, reason := range e.reasons {
+		if reason == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *transactionCanceledError) Error() string {
+	var failures []string
+	for i, reason := range e.reasons {
+		if reason == "None" || i >= len(e.operations) {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", e.operations[i], reason))
+	}
+	if len(failures) == 0 {
+		return "Transaction cancelled, nothing was written: " + e.err.Message()
+	}
+	return "Transaction cancelled, nothing was written:\n" + strings.Join(failures, "\n")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// TransactWriteItems cancels the transaction if any item is a put of an item
+// with a "fail" attribute, giving a reason for each item as DynamoDB does.
+func (d *mockDynamo) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	d.transaction = input
+	var reasons []string
+	failed := false
+	for _, item := range input.TransactItems {
+		if item.Put != nil && item.Put.Item["fail"] != nil {
+			reasons = append(reasons, "ConditionalCheckFailed")
+			failed = true
+		} else {
+			reasons = append(reasons, "None")
+		}
+	}
+	if failed {
+		return nil, awserr.New(dynamodb.ErrCodeTransactionCanceledException, "Transaction cancelled, please refer cancellation reasons for specific reasons ["+strings.Join(reasons, ", ")+"]", nil)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func transactSetup(t *testing.T, script string) (*mockDynamo, error) {
+	operations, err := readTransactScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	client := &mockDynamo{}
+	_, err = run(ddbArgs{
+		Client:     client,
+		Command:    "transact",
+		Operations: operations,
+	})
+	return client, err
+}
+
+func TestTransact(t *testing.T) {
+	client, err := transactSetup(t, `# Move a copy of 1984 to another shelf
+put shelves shelf="b",book="1984" if attribute_not_exists(shelf)
+
+update books key book="1984" set copies=copies-1 if copies > 0
+DELETE shelves shelf="a",book="1984"
+condition-check authors author="George Orwell" if attribute_exists(author)
+`)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	items := client.transaction.TransactItems
+	if len(items) != 4 {
+		t.Fatalf("Expected 4 operations, got %d", len(items))
+	}
+
+	put := items[0].Put
+	if *put.TableName != "shelves" || *put.Item["book"].S != "1984" {
+		t.Errorf("Expected a put of the item, got %s", put)
+	}
+	if *put.ConditionExpression != "attribute_not_exists(#n0)" || *put.ExpressionAttributeNames["#n0"] != "shelf" {
+		t.Errorf("Expected the put to have a condition, got %s", put)
+	}
+
+	update := items[1].Update
+	if *update.TableName != "books" || *update.Key["book"].S != "1984" {
+		t.Errorf("Expected an update of the key, got %s", update)
+	}
+	if *update.UpdateExpression != "SET #n0 = #n0 - :v0" || *update.ConditionExpression != "#n0 > :v1" {
+		t.Errorf("Expected placeholders to be shared by the update and condition, got %s", update)
+	}
+
+	remove := items[2].Delete
+	if *remove.TableName != "shelves" || len(remove.Key) != 2 || remove.ConditionExpression != nil || remove.ExpressionAttributeNames != nil {
+		t.Errorf("Expected a delete without a condition, got %s", remove)
+	}
+
+	check := items[3].ConditionCheck
+	if *check.TableName != "authors" || *check.Key["author"].S != "George Orwell" || *check.ConditionExpression != "attribute_exists(#n0)" {
+		t.Errorf("Expected a condition check, got %s", check)
+	}
+}
+
+func TestTransactCanceled(t *testing.T) {
+	_, err := transactSetup(t, `update books key book="1984" set copies=3
+put books book="1984",fail=true if attribute_not_exists(book)
+`)
+	cerr, ok := err.(*transactionCanceledError)
+	if !ok {
+		t.Fatalf("Expected a transactionCanceledError, got %v", err)
+	}
+	if !cerr.conditionFailed() {
+		t.Errorf("Expected the condition to have failed")
+	}
+	expected := "Transaction cancelled, nothing was written:\nline 2 (put books): ConditionalCheckFailed"
+	if cerr.Error() != expected {
+		t.Errorf("Expected %s, got %s", expected, cerr)
+	}
+}
+
+func TestTransactCanceledWithoutReasons(t *testing.T) {
+	err := newTransactionCanceledError(awserr.New(dynamodb.ErrCodeTransactionCanceledException, "Transaction is ongoing", nil), nil)
+	if err.conditionFailed() {
+		t.Errorf("Expected no condition to have failed")
+	}
+	if err.Error() != "Transaction cancelled, nothing was written: Transaction is ongoing" {
+		t.Errorf("Expected the message from DynamoDB, got %s", err)
+	}
+}
+
+func TestTransactScriptErrors(t *testing.T) {
+	scripts := map[string]string{
+		`put books`:                                 "Invalid statement at line 1, column 1: expected an operation, a table and a statement",
+		"\nreplace books book=\"1984\"":             "Invalid statement at line 2, column 1: unknown operation replace, expected put, update, delete or condition-check",
+		`condition-check books book="1984"`:         "Invalid statement at line 1, column 34: a condition-check needs an if condition",
+		`delete books a="1",b="2",c="3"`:            "Invalid statement at line 1, column 14: expected one or two key=value pair(s) for a delete",
+		`update books book="1984" set copies=3`:     "Invalid statement at line 1, column 14: ",
+		`put books book="1984" if attribute_exists`: "Invalid statement at line 1, column 23: ",
+		`put  books a=hello world`: `Invalid statement at line 1, column 20: unexpected trailing token "world"
+  put  books a=hello world
+                     ^`,
+	}
+	for script, expected := range scripts {
+		_, err := readTransactScript(strings.NewReader(script))
+		if _, ok := err.(*parseError); !ok || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Expected %s to fail with %s, got %v", script, expected, err)
+		}
+	}
+}
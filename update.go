@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/scanner"
+
+	"github.com/alecthomas/participle"
+	"github.com/alecthomas/participle/lexer"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var validUpdateReturnValues = map[string]bool{
+	"NONE":        true,
+	"ALL_OLD":     true,
+	"UPDATED_OLD": true,
+	"ALL_NEW":     true,
+	"UPDATED_NEW": true,
+}
+
+// updateStatement is the grammar for the update command, for example:
+//
+//	key pk="a" set count=count+1, tags=list_append(tags,["x"]) remove obsolete add seen=("u1")
+//
+// Unlike other statements, unquoted words on the right hand side of a set
+// action refer to attributes, so string literals must be quoted.
+type updateStatement struct {
+	Key     *keyValue       `"key" @@`
+	Clauses []*updateClause `@@ { @@ }`
+}
+
+type updateClause struct {
+	Set    []*setAction    `  "set" @@ { "," @@ }`
+	Remove []*documentPath `| "remove" @@ { "," @@ }`
+	Add    []*updateValue  `| "add" @@ { "," @@ }`
+	Delete []*updateValue  `| "delete" @@ { "," @@ }`
+}
+
+type setAction struct {
+	Path     *documentPath  `@@ "="`
+	Left     *updateOperand `@@`
+	Operator string         `[ @( "+" | "-" )`
+	Right    *updateOperand `  @@ ]`
+}
+
+type updateValue struct {
+	Path  *documentPath `@@ "="`
+	Value *value        `@@`
+}
+
+type updateOperand struct {
+	Function *updateFunction `  @@`
+	Element  *elementPath    `| @@`
+	literal
+	Quoted *string       `| @String`
+	Path   *documentPath `| @@`
+	Value  *value        `| @@`
+}
+
+// elementPath is a path that starts with a list index, such as l[0].x. It's
+// tried before casts, so that L[0] is the first element of the attribute L
+// rather than a list cast, while NS[1,2] is still a cast.
+type elementPath struct {
+	Start listIndex     `@@`
+	Path  *documentPath `@@`
+}
+
+// listIndex matches without reading any tokens when the next tokens are a
+// name followed by a list index, as the grammar only looks one token ahead.
+type listIndex struct{}
+
+func (l *listIndex) Parse(lex lexer.PeekingLexer) error {
+	var tokens [4]lexer.Token
+	for i := range tokens {
+		token, err := lex.Peek(i)
+		if err != nil {
+			return err
+		}
+		tokens[i] = token
+	}
+	if tokens[0].Type != scanner.Ident || tokens[1].Value != "[" || tokens[2].Type != scanner.Int || tokens[3].Value != "]" {
+		return participle.NextMatch
+	}
+	return nil
+}
+
+type updateFunction struct {
+	Name      string           `@( "list_append" | "if_not_exists" ) "("`
+	Arguments []*updateOperand `@@ { "," @@ } ")"`
+}
+
+func (u *updateStatement) expression(e *expressionBuilder) string {
+	var sets, removes, adds, deletes []string
+	for _, clause := range u.Clauses {
+		for _, action := range clause.Set {
+			sets = append(sets, action.expression(e))
+		}
+		for _, path := range clause.Remove {
+			removes = append(removes, path.expression(e))
+		}
+		for _, action := range clause.Add {
+			adds = append(adds, action.expression(e))
+		}
+		for _, action := range clause.Delete {
+			deletes = append(deletes, action.expression(e))
+		}
+	}
+
+	var expression []string
+	if len(sets) > 0 {
+		expression = append(expression, "SET "+strings.Join(sets, ", "))
+	}
+	if len(removes) > 0 {
+		expression = append(expression, "REMOVE "+strings.Join(removes, ", "))
+	}
+	if len(adds) > 0 {
+		expression = append(expression, "ADD "+strings.Join(adds, ", "))
+	}
+	if len(deletes) > 0 {
+		expression = append(expression, "DELETE "+strings.Join(deletes, ", "))
+	}
+	return strings.Join(expression, " ")
+}
+
+func (s *setAction) expression(e *expressionBuilder) string {
+	if s.Right == nil {
+		return fmt.Sprintf("%s = %s", s.Path.expression(e), s.Left.expression(e))
+	}
+	return fmt.Sprintf("%s = %s %s %s", s.Path.expression(e), s.Left.expression(e), s.Operator, s.Right.expression(e))
+}
+
+func (u *updateValue) expression(e *expressionBuilder) string {
+	return fmt.Sprintf("%s %s", u.Path.expression(e), e.literal(u.Value))
+}
+
+func (o *updateOperand) expression(e *expressionBuilder) string {
+	switch {
+	case o.Function != nil:
+		var arguments []string
+		for _, a := range o.Function.Arguments {
+			arguments = append(arguments, a.expression(e))
+		}
+		return fmt.Sprintf("%s(%s)", strings.ToLower(o.Function.Name), strings.Join(arguments, ", "))
+	case o.Element != nil:
+		return o.Element.Path.expression(e)
+	case o.Quoted != nil:
+		return e.literal(&value{String: o.Quoted})
+	case o.Path != nil:
+		return o.Path.expression(e)
+	case o.Value != nil:
+		return e.literal(o.Value)
+	}
+	return e.literal(&value{literal: o.literal})
+}
+
+func update(args ddbArgs) (string, error) {
+	key, err := buildKey(args.Update.Key.Attributes)
+	if err != nil {
+		return "", err
+	}
+	builder := newExpressionBuilder()
+	updateExpression := args.Update.expression(builder)
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:        &args.Table,
+		Key:              key,
+		UpdateExpression: &updateExpression,
+	}
+	if args.Condition != nil {
+		input.ConditionExpression = aws.String(args.Condition.expression(builder))
+	}
+	if builder.err != nil {
+		return "", builder.err
+	}
+	input.ExpressionAttributeNames = builder.attributeNames()
+	input.ExpressionAttributeValues = builder.attributeValues()
+	if args.ReturnValues != "" {
+		input.ReturnValues = &args.ReturnValues
+	}
+	resp, err := args.Client.UpdateItem(input)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Attributes) == 0 {
+		return "", nil
+	}
+	return marshalItem(resp.Attributes, args.Format)
+}
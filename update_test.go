@@ -0,0 +1,241 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func updateSetup(statement string) (*updateStatement, error) {
+	update := &updateStatement{}
+	err := parseStatement(statement, update)
+	return update, err
+}
+
+func (d *mockDynamo) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	d.updateInput = input
+	return &dynamodb.UpdateItemOutput{
+		Attributes: map[string]*dynamodb.AttributeValue{
+			"count": {
+				N: aws.String("2"),
+			},
+		},
+	}, nil
+}
+
+func TestParserUpdate(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set count=count+1, tags=list_append(tags,["x"]) remove obsolete add seen=("u1")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ast.Key.Attributes) != 1 {
+		t.Fatalf("Expected one key attribute, got %d", len(ast.Key.Attributes))
+	}
+	if ast.Key.Attributes[0].Key != "pk" {
+		t.Errorf("Expected key to be 'pk', got '%s'", ast.Key.Attributes[0].Key)
+	}
+	if len(ast.Clauses) != 3 {
+		t.Fatalf("Expected three clauses, got %d", len(ast.Clauses))
+	}
+	if len(ast.Clauses[0].Set) != 2 {
+		t.Fatalf("Expected two set actions, got %d", len(ast.Clauses[0].Set))
+	}
+	if ast.Clauses[0].Set[0].Left.Path.Name != "count" {
+		t.Errorf("Expected set to reference 'count', got '%s'", ast.Clauses[0].Set[0].Left.Path.Name)
+	}
+	if ast.Clauses[0].Set[1].Left.Function.Name != "list_append" {
+		t.Errorf("Expected function to be 'list_append', got '%s'", ast.Clauses[0].Set[1].Left.Function.Name)
+	}
+	if ast.Clauses[1].Remove[0].Name != "obsolete" {
+		t.Errorf("Expected remove to reference 'obsolete', got '%s'", ast.Clauses[1].Remove[0].Name)
+	}
+	if *ast.Clauses[2].Add[0].Value.Set[0].String != "u1" {
+		t.Errorf("Expected add value to be 'u1', got '%s'", *ast.Clauses[2].Add[0].Value.Set[0].String)
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	tests := []struct {
+		statement  string
+		expression string
+	}{
+		{`key pk="a" set a=1`, "SET #n0 = :v0"},
+		{`key pk="a" set a=b`, "SET #n0 = #n1"},
+		{`key pk="a" set a=true`, "SET #n0 = :v0"},
+		{`key pk="a" set a=null`, "SET #n0 = :v0"},
+		{`key pk="a" set count=count+1`, "SET #n0 = #n0 + :v0"},
+		{`key pk="a" set count=count-1`, "SET #n0 = #n0 - :v0"},
+		{`key pk="a" set a.b[1].c="x"`, "SET #n0.#n1[1].#n2 = :v0"},
+		{`key pk="a" set a=if_not_exists(a, 0)`, "SET #n0 = if_not_exists(#n0, :v0)"},
+		{`key pk="a" SET a=1 REMOVE b`, "SET #n0 = :v0 REMOVE #n1"},
+		{`key pk="a" remove b, c[0]`, "REMOVE #n0, #n1[0]"},
+		{`key pk="a" delete tags=("x","y")`, "DELETE #n0 :v0"},
+		{`key pk="a" set a=1 remove b set c=2`, "SET #n0 = :v0, #n2 = :v1 REMOVE #n1"},
+	}
+	for _, test := range tests {
+		ast, err := updateSetup(test.statement)
+		if err != nil {
+			t.Fatalf("Error parsing %s: %s", test.statement, err)
+		}
+		expression := ast.expression(newExpressionBuilder())
+		if expression != test.expression {
+			t.Errorf("Expected expression for %s to be '%s', got '%s'", test.statement, test.expression, expression)
+		}
+	}
+}
+
+func TestParserUpdateWithoutClauses(t *testing.T) {
+	_, err := updateSetup(`key pk="a"`)
+	if err == nil {
+		t.Error("Expected an error parsing an update without any clauses")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	client := &mockDynamo{}
+	statement, err := updateSetup(`key pk="a",sk=1 set count=count+1, flag=false`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := ddbArgs{
+		Client:       client,
+		Command:      "update",
+		Update:       statement,
+		Table:        "testing",
+		ReturnValues: "UPDATED_NEW",
+	}
+	output, err := run(args)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %s", err)
+	}
+	if output != `{"count":2}` {
+		t.Errorf("Expected result to be the updated attributes, got '%s'", output)
+	}
+	if len(client.updateInput.Key) != 2 {
+		t.Errorf("Expected Key to contain 2 attributes, got %d", len(client.updateInput.Key))
+	}
+	if *client.updateInput.UpdateExpression != "SET #n0 = #n0 + :v0, #n1 = :v1" {
+		t.Errorf("Unexpected UpdateExpression '%s'", *client.updateInput.UpdateExpression)
+	}
+	if *client.updateInput.ExpressionAttributeValues[":v1"].BOOL != false {
+		t.Errorf("Expected :v1 to be false")
+	}
+	if *client.updateInput.ReturnValues != "UPDATED_NEW" {
+		t.Errorf("Expected ReturnValues to be 'UPDATED_NEW', got '%s'", *client.updateInput.ReturnValues)
+	}
+}
+
+func TestUpdateCast(t *testing.T) {
+	ast, err := updateSetup(`key pk=S(1) set a=NS(1,2), b=S + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	values := builder.attributeValues()
+	if expression != "SET #n0 = :v0, #n1 = #n2 + :v1" {
+		t.Errorf("Expected S on its own to be an attribute, got %s", expression)
+	}
+	if len(values[":v0"].NS) != 2 {
+		t.Errorf("Expected a number set, got %s", values)
+	}
+	key, err := buildKey(ast.Key.Attributes)
+	if err != nil || *key["pk"].S != "1" {
+		t.Errorf("Expected the key to be the string 1, got %s (%v)", key, err)
+	}
+}
+
+func TestUpdateCastKeywordPaths(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set a=l[0], b=b[0], c=ss[1] + 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	if expression != "SET #n0 = #n1[0], #n2 = #n2[0], #n3 = #n4[1] + :v0" {
+		t.Errorf("Expected list elements of attributes named like types, got %s", expression)
+	}
+	if err := builder.err; err != nil {
+		t.Errorf("Expected no error, but got %s", err)
+	}
+}
+
+func TestUpdateBracketCast(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set a=NS[1,2], b=list_append(b, L["x"]), c=l[0].x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	if expression != "SET #n0 = :v0, #n1 = list_append(#n1, :v1), #n2 = #n3[0].#n4" {
+		t.Errorf("Expected casts in brackets and a list element, got %s", expression)
+	}
+	values := builder.attributeValues()
+	if len(values[":v0"].NS) != 2 || len(values[":v1"].L) != 1 {
+		t.Errorf("Expected a number set and a list, got %s", values)
+	}
+}
+
+func TestUpdateQuotedNames(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set "Batting Avg"="x", stats."Home Runs"=runs remove "Old Name"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	if expression != "SET #n0 = :v0, #n1.#n2 = #n3 REMOVE #n4" {
+		t.Errorf("Expected quoted names on the left and a string on the right, got %s", expression)
+	}
+	if names := builder.attributeNames(); *names["#n0"] != "Batting Avg" || *names["#n2"] != "Home Runs" {
+		t.Errorf("Expected the quoted names, got %v", aws.StringValueMap(names))
+	}
+	if values := builder.attributeValues(); *values[":v0"].S != "x" {
+		t.Errorf("Expected a quoted value to be a string, got %s", values)
+	}
+}
+
+func TestUpdateObject(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set c=map{x: 1, tags: ("a")}, d=map`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	if expression != "SET #n0 = :v0, #n1 = #n2" {
+		t.Errorf("Expected map on its own to be an attribute, got %s", expression)
+	}
+	values := builder.attributeValues()
+	if m := values[":v0"].M; m == nil || *m["x"].N != "1" || len(m["tags"].SS) != 1 {
+		t.Errorf("Expected a map, got %s", values)
+	}
+}
+
+func TestUpdateInlineBinary(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set a=b64"SGk=", b=hex"00ff", c=hex`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	expression := ast.expression(builder)
+	if expression != "SET #n0 = :v0, #n1 = :v1, #n2 = #n3" {
+		t.Errorf("Expected hex on its own to be an attribute, got %s", expression)
+	}
+	values := builder.attributeValues()
+	if string(values[":v0"].B) != "Hi" || string(values[":v1"].B) != "\x00\xff" {
+		t.Errorf("Expected binary values, got %s", values)
+	}
+}
+
+func TestUpdateNull(t *testing.T) {
+	ast, err := updateSetup(`key pk="a" set a=null, b=list_append(b, [null])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := newExpressionBuilder()
+	ast.expression(builder)
+	values := builder.attributeValues()
+	if values[":v0"].NULL == nil || values[":v1"].L[0].NULL == nil {
+		t.Errorf("Expected null values, got %s", values)
+	}
+}